@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+const authUsage = `usage: auth login
+       auth logout
+       auth status`
+
+// AuthStatus is the cached token of a profile and the account it belongs to
+type AuthStatus struct {
+	Profile string `json:"profile"`
+	onedrive.TokenStatus
+	Account string `json:"account,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// auth signs the profile in or out, or shows its sign in status
+func auth(ctx context.Context, profile *Profile, args []string, out io.Writer, asJSON bool) error {
+	if len(args) != 1 {
+		return usageError(authUsage)
+	}
+	if profile.AppOnly {
+		return fmt.Errorf("Profile %s authenticates as an app, there is nothing to sign in to", profile.Name)
+	}
+	baseURL, drive, config, opts, err := profileConfig(profile)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "login":
+		client, err := onedrive.Login(ctx, profile.AppName(), config, opts)
+		if err != nil {
+			return err
+		}
+		account, err := accountName(ctx, profileAPI(profile, client, baseURL, drive))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Signed in to profile %s as %s\n", profile.Name, account)
+		return nil
+	case "logout":
+		revoked, err := onedrive.Logout(ctx, profile.AppName(), config, opts)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			fmt.Fprintf(out, "Signed out of profile %s and revoked its token\n", profile.Name)
+		} else {
+			fmt.Fprintf(out, "Signed out of profile %s\n", profile.Name)
+		}
+		return nil
+	case "status":
+		token, err := onedrive.CachedTokenStatus(profile.AppName(), config, opts)
+		if err != nil {
+			return err
+		}
+		status := &AuthStatus{Profile: profile.Name, TokenStatus: *token}
+		if status.SignedIn && !status.Encrypted {
+			api, err := connect(ctx, profile, false)
+			if err == nil {
+				status.Account, err = accountName(ctx, api)
+			}
+			if err != nil {
+				status.Error = err.Error()
+			}
+		}
+		return PrintAuthStatus(out, status, time.Now(), asJSON)
+	}
+	return usageError(authUsage)
+}
+
+// accountName returns the name of the owner of the drive
+func accountName(ctx context.Context, api *onedrive.OneDriveAPI) (string, error) {
+	drive, err := api.QuotaContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if drive.Owner == nil || drive.Owner.User == nil {
+		return "unknown", nil
+	}
+	return drive.Owner.User.DisplayName, nil
+}
+
+// PrintAuthStatus writes the status either as a list or as JSON
+func PrintAuthStatus(out io.Writer, status *AuthStatus, now time.Time, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Profile:\t%s\n", status.Profile)
+	fmt.Fprintf(w, "Cache file:\t%s\n", status.CacheFile)
+	switch {
+	case !status.SignedIn:
+		fmt.Fprintln(w, "Account:\tnot signed in")
+		return w.Flush()
+	case status.Encrypted:
+		fmt.Fprintln(w, "Account:\tunknown, the token is encrypted and no passphrase was given")
+		return w.Flush()
+	case status.Error != "":
+		fmt.Fprintf(w, "Account:\terror: %s\n", status.Error)
+	default:
+		fmt.Fprintf(w, "Account:\t%s\n", status.Account)
+	}
+
+	scopes := "unknown"
+	if len(status.Scopes) > 0 {
+		scopes = strings.Join(status.Scopes, " ")
+	}
+	fmt.Fprintf(w, "Scopes:\t%s\n", scopes)
+
+	expiry := "never"
+	if !status.Expiry.IsZero() {
+		expiry = status.Expiry.Format(time.RFC3339)
+		if status.Expiry.Before(now) && status.Refreshable {
+			expiry += " (expired, refreshed on next use)"
+		} else if status.Expiry.Before(now) {
+			expiry += " (expired, sign in again)"
+		}
+	}
+	fmt.Fprintf(w, "Access token expires:\t%s\n", expiry)
+	return w.Flush()
+}
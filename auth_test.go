@@ -0,0 +1,61 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnwhiteh/cloud-backup"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+func TestPrintAuthStatus(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	status := &main.AuthStatus{
+		Profile: "work",
+		TokenStatus: onedrive.TokenStatus{
+			CacheFile:   "/home/user/.cache/onedrive-sync-work-token1",
+			SignedIn:    true,
+			Scopes:      []string{"Files.ReadWrite", "offline_access"},
+			Expiry:      now.Add(-time.Minute),
+			Refreshable: true,
+		},
+		Account: "Jane Doe",
+	}
+
+	var out bytes.Buffer
+	if err := main.PrintAuthStatus(&out, status, now, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Account:               Jane Doe",
+		"Scopes:                Files.ReadWrite offline_access",
+		"Access token expires:  2026-10-18T11:59:00Z (expired, refreshed on next use)",
+		"Cache file:            /home/user/.cache/onedrive-sync-work-token1",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in %q", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	status = &main.AuthStatus{Profile: "default", TokenStatus: onedrive.TokenStatus{CacheFile: "token"}}
+	main.PrintAuthStatus(&out, status, now, false)
+	if !strings.Contains(out.String(), "not signed in") || strings.Contains(out.String(), "Scopes") {
+		t.Errorf("unexpected output when not signed in: %q", out.String())
+	}
+
+	out.Reset()
+	if err := main.PrintAuthStatus(&out, status, now, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s", err)
+	}
+	if decoded["profile"] != "default" || decoded["cache_file"] != "token" || decoded["signed_in"] != false {
+		t.Errorf("unexpected JSON output: %s", out.String())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HashCache keeps the hashes of local files between runs, so that a file is
+// only read again when its size or modification time has changed. The hashes
+// of each folder are kept in a file of their own in the cache directory.
+type HashCache struct {
+	dir     string
+	folders map[string]*cachedFolder // by absolute path
+}
+
+// cachedFolder are the hashes of the files in a folder, by the type of hash
+// and the name of the file
+type cachedFolder struct {
+	Folder string                `json:"folder"`
+	Hashes map[string]cachedHash `json:"hashes"`
+
+	seen  map[string]bool // the hashes looked up or added in this run
+	dirty bool            // whether hashes were added in this run
+}
+
+type cachedHash struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Hash     string    `json:"hash"`
+}
+
+func NewHashCache(dir string) *HashCache {
+	return &HashCache{dir: dir, folders: make(map[string]*cachedFolder)}
+}
+
+// Get returns the cached hash of the given type of the file, if it has the
+// same size and modification time as when it was hashed
+func (c *HashCache) Get(path string, stat os.FileInfo, hashType string) (string, bool) {
+	folder, key := c.folder(path), hashKey(path, hashType)
+	cached, ok := folder.Hashes[key]
+	if !ok || cached.Size != stat.Size() || !cached.Modified.Equal(stat.ModTime()) {
+		return "", false
+	}
+	folder.seen[key] = true
+	return cached.Hash, true
+}
+
+// Put adds the hash of the given type of the file
+func (c *HashCache) Put(path string, stat os.FileInfo, hashType, hash string) {
+	folder, key := c.folder(path), hashKey(path, hashType)
+	folder.Hashes[key] = cachedHash{Size: stat.Size(), Modified: stat.ModTime(), Hash: hash}
+	folder.seen[key] = true
+	folder.dirty = true
+}
+
+// Save writes the hashes of the folders that were used in this run. The
+// hashes of files that weren't looked up are dropped, as the files may be
+// gone.
+func (c *HashCache) Save() error {
+	for _, folder := range c.folders {
+		if !folder.dirty && len(folder.seen) == len(folder.Hashes) {
+			continue
+		}
+		for key := range folder.Hashes {
+			if !folder.seen[key] {
+				delete(folder.Hashes, key)
+			}
+		}
+
+		contents, err := json.Marshal(folder)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(c.dir, 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(c.filename(folder.Folder), contents, 0600); err != nil {
+			return err
+		}
+		folder.dirty = false
+	}
+	return nil
+}
+
+// folder returns the cached hashes of the folder of the file, reading them
+// on first use. A missing or unreadable cache file is simply empty.
+func (c *HashCache) folder(path string) *cachedFolder {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		dir = filepath.Dir(path)
+	}
+	if folder, ok := c.folders[dir]; ok {
+		return folder
+	}
+
+	folder := &cachedFolder{}
+	if contents, err := ioutil.ReadFile(c.filename(dir)); err == nil {
+		json.Unmarshal(contents, folder)
+	}
+	if folder.Folder != dir || folder.Hashes == nil {
+		folder.Hashes = make(map[string]cachedHash)
+	}
+	folder.Folder = dir
+	folder.seen = make(map[string]bool)
+	c.folders[dir] = folder
+	return folder
+}
+
+// filename returns the file the hashes of the folder are kept in
+func (c *HashCache) filename(folder string) string {
+	h := fnv.New64a()
+	h.Write([]byte(folder))
+	return filepath.Join(c.dir, fmt.Sprintf("%016x.json", h.Sum64()))
+}
+
+// hashKey returns the key of the hash of the given type of a file in the
+// hashes of its folder. File names can't contain a slash.
+func hashKey(path, hashType string) string {
+	return hashType + "/" + filepath.Base(path)
+}
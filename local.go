@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,6 +27,10 @@ type LocalFilesystem struct {
 	hasher  hash.Hash
 	opener  FileOpener
 	globber Globber
+
+	hashType string                          // the type of hash of hasher, if known
+	newHash  func(hashType string) hash.Hash // creates other types of hash for Rehash
+	cache    *HashCache                      // the hashes of earlier runs, if any
 }
 
 var OSOpener = func(name string) (File, error) {
@@ -48,7 +53,22 @@ func NewLocalFilesystem(hasher hash.Hash, opener FileOpener, globber Globber) Lo
 		globber = filepath.Glob
 	}
 
-	return LocalFilesystem{hasher, opener, globber}
+	return LocalFilesystem{hasher: hasher, opener: opener, globber: globber}
+}
+
+// SetHashTypes names the type of hash files are hashed with, and sets the
+// function that creates a hash of another type, or nil if it doesn't know the
+// type, for files compared with files that only have that type.
+func (f *LocalFilesystem) SetHashTypes(hashType string, newHash func(hashType string) hash.Hash) {
+	f.hashType = hashType
+	f.newHash = newHash
+}
+
+// SetHashCache keeps the hashes of files in the cache, so that unchanged
+// files aren't read again in the next run. Only hashes of a named type are
+// cached, see SetHashTypes.
+func (f *LocalFilesystem) SetHashCache(cache *HashCache) {
+	f.cache = cache
 }
 
 func (f *LocalFilesystem) Files(path string) ([]HashedFile, error) {
@@ -64,7 +84,7 @@ func (f *LocalFilesystem) Files(path string) ([]HashedFile, error) {
 			continue
 		}
 
-		hash, err := f.Hash(match)
+		hash, stat, err := f.hash(match)
 		if err == errIsDirectory {
 			// we skip directories
 			continue
@@ -78,34 +98,98 @@ func (f *LocalFilesystem) Files(path string) ([]HashedFile, error) {
 			Folder:   filepath.Dir(match),
 			Filename: filepath.Base(match),
 			Hash:     hash,
+			HashType: f.hashType,
+			Size:     stat.Size(),
+			Modified: stat.ModTime(),
 		})
 	}
 
+	f.saveHashes()
 	return results, nil
 }
 
 var errIsDirectory = errors.New("File is a directory")
 
 func (f *LocalFilesystem) Hash(path string) (string, error) {
+	hash, _, err := f.hash(path)
+	return hash, err
+}
+
+// Rehash hashes the files whose name is in hashTypes again with the type of
+// hash given there. Files are left unchanged if the type is not known.
+func (f *LocalFilesystem) Rehash(files []HashedFile, hashTypes map[string]string) error {
+	if f.newHash == nil {
+		return nil
+	}
+	for idx, file := range files {
+		hashType, ok := hashTypes[file.Filename]
+		if !ok {
+			continue
+		}
+		hasher := f.newHash(hashType)
+		if hasher == nil {
+			continue
+		}
+		hash, _, err := f.hashWith(hasher, hashType, file.LocalPath())
+		if err != nil {
+			return err
+		}
+		files[idx].Hash, files[idx].HashType = hash, hashType
+	}
+	f.saveHashes()
+	return nil
+}
+
+// saveHashes saves the hash cache, if there is one. The hashes are only a
+// cache, so a failure is logged rather than returned.
+func (f *LocalFilesystem) saveHashes() {
+	if f.cache == nil {
+		return
+	}
+	if err := f.cache.Save(); err != nil {
+		log.Printf("Warning: failed to save the hashes of local files: %s", err)
+	}
+}
+
+// hash returns the hash of the file along with its os.FileInfo
+func (f *LocalFilesystem) hash(path string) (string, os.FileInfo, error) {
+	return f.hashWith(f.hasher, f.hashType, path)
+}
+
+// hashWith returns the hash of the file computed with the given hasher, along
+// with its os.FileInfo. Hashes of a named type come from the hash cache if
+// the file hasn't changed since.
+func (f *LocalFilesystem) hashWith(hasher hash.Hash, hashType, path string) (string, os.FileInfo, error) {
 	file, err := f.opener(path)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer file.Close()
 
 	stat, err := file.Stat()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	// skip directories by returning an error
 	if stat.IsDir() {
-		return "", errIsDirectory
+		return "", nil, errIsDirectory
+	}
+
+	cached := f.cache != nil && hashType != ""
+	if cached {
+		if hash, ok := f.cache.Get(path, stat, hashType); ok {
+			return hash, stat, nil
+		}
 	}
 
-	f.hasher.Reset()
-	io.Copy(f.hasher, file)
-	return fmt.Sprintf("%x", f.hasher.Sum(nil)), nil
+	hasher.Reset()
+	io.Copy(hasher, file)
+	hash := fmt.Sprintf("%x", hasher.Sum(nil))
+	if cached {
+		f.cache.Put(path, stat, hashType, hash)
+	}
+	return hash, stat, nil
 }
 
 // Return an io.ReadCloser that contains the contents of the file
@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"bytes"
+	"crypto/md5"
 	"fmt"
 	"log"
 	"os"
@@ -67,8 +68,11 @@ func (fi mockFileInfo) Mode() os.FileMode {
 	}
 }
 
+// mockModTime is the modification time of every mock file
+var mockModTime = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
 func (fi mockFileInfo) ModTime() time.Time {
-	return time.Now()
+	return mockModTime
 }
 
 func (fi mockFileInfo) IsDir() bool {
@@ -96,8 +100,8 @@ func TestNormal(t *testing.T) {
 		log.Fatalf("Error getting files: %s", err)
 	}
 	expected := []main.HashedFile{
-		{".", "foo", "5172373545499a04bc8a03681dc9ab55"},
-		{".", "bar", "29228460db10bba1415bd0106de0e974"},
+		{Folder: ".", Filename: "foo", Hash: "5172373545499a04bc8a03681dc9ab55", Size: 12, Modified: mockModTime},
+		{Folder: ".", Filename: "bar", Hash: "29228460db10bba1415bd0106de0e974", Size: 12, Modified: mockModTime},
 	}
 
 	ok := reflect.DeepEqual(expected, files)
@@ -157,3 +161,66 @@ func TestDontRecurse(t *testing.T) {
 		}
 	}
 }
+
+// countingFile counts the reads of a mock file
+type countingFile struct {
+	file  *mockFile
+	reads *int
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	*f.reads++
+	return f.file.Read(p)
+}
+
+func (f *countingFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *countingFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func TestHashCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	contents := map[string]string{"foo": "contents:foo", "bar": "contents:bar"}
+	reads := 0
+	globber := func(path string) ([]string, error) {
+		return []string{"foo", "bar"}, nil
+	}
+	opener := func(path string) (main.File, error) {
+		return &countingFile{&mockFile{bytes.NewBufferString(contents[path]), path, false}, &reads}, nil
+	}
+	files := func() []main.HashedFile {
+		fs := main.NewLocalFilesystem(nil, opener, globber)
+		fs.SetHashTypes("md5", nil)
+		fs.SetHashCache(main.NewHashCache(cacheDir))
+		files, err := fs.Files(".")
+		if err != nil {
+			t.Fatalf("Error getting files: %s", err)
+		}
+		return files
+	}
+
+	first := files()
+	if reads == 0 {
+		t.Fatalf("expected the files to be read")
+	}
+
+	// the next run finds the hashes in the cache
+	reads = 0
+	if second := files(); !reflect.DeepEqual(first, second) || reads != 0 {
+		t.Errorf("expected the cached hashes %v without reading, got %v after %d reads", first, second, reads)
+	}
+
+	// a changed file is read again
+	contents["foo"] = "changed contents"
+	reads = 0
+	third := files()
+	if expected := fmt.Sprintf("%x", md5.Sum([]byte("changed contents"))); third[0].Hash != expected || third[1].Hash != first[1].Hash {
+		t.Errorf("expected only foo to change to %s, got %v", expected, third)
+	}
+	if reads == 0 {
+		t.Errorf("expected the changed file to be read")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+const lsUsage = `usage: ls [remote folder]`
+
+// ls lists the remote folder, which defaults to the backup root
+func ls(ctx context.Context, api *onedrive.OneDriveAPI, args []string, root string, out io.Writer, asJSON bool) error {
+	if len(args) > 1 {
+		return usageError(lsUsage)
+	}
+	if len(args) == 1 {
+		root = args[0]
+	}
+
+	items, err := api.ChildrenContext(ctx, root)
+	if err != nil {
+		return err
+	}
+	return PrintItems(out, items, asJSON)
+}
+
+// listEntry is how an item is printed as JSON
+type listEntry struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Hash     string    `json:"hash,omitempty"`
+	Folder   bool      `json:"folder,omitempty"`
+}
+
+// PrintItems writes the files and folders either as a table or as JSON.
+// Folder names end in a slash in the table.
+func PrintItems(out io.Writer, items []*onedrive.Item, asJSON bool) error {
+	entries := []listEntry{}
+	for _, item := range items {
+		entry := listEntry{Name: item.Name, Size: int64(item.Size), Folder: item.Folder != nil}
+		if item.FileSystemInfo != nil {
+			entry.Modified = item.FileSystemInfo.LastModifiedDateTime
+		}
+		if item.File != nil && item.File.Hashes != nil {
+			entry.Hash = strings.ToLower(item.File.Hashes.Sha1Hash)
+			if entry.Hash == "" {
+				entry.Hash = item.File.Hashes.QuickXorHash
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tMODIFIED\tHASH")
+	for _, entry := range entries {
+		name, size, modified, hash := entry.Name, humanize.Bytes(uint64(entry.Size)), "-", entry.Hash
+		if entry.Folder {
+			name, size, hash = name+"/", "-", "-"
+		} else if hash == "" {
+			hash = "-"
+		}
+		if !entry.Modified.IsZero() {
+			modified = entry.Modified.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, size, modified, hash)
+	}
+	return w.Flush()
+}
@@ -1,4 +1,520 @@
 package main
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+	"golang.org/x/oauth2"
+)
+
+var (
+	secretFile   = flag.String("secret_file", "client_secrets.json", "client secrets JSON file")
+	clientID     = flag.String("client_id", "", "application id registered with the Microsoft identity platform, instead of -secret_file and $"+clientIDEnv)
+	tenant       = flag.String("tenant", onedrive.CommonTenant, "Microsoft identity platform tenant: common, consumers, organizations, a tenant id or domain")
+	redirectHost = flag.String("redirect_host", onedrive.DefaultRedirectHost, "host to redirect with oauth success")
+	redirectPort = flag.String("redirect_port", onedrive.DefaultRedirectPort, "port to redirect with oauth success")
+	deviceCode   = flag.Bool("device_code", false, "sign in with a code on another device instead of a local browser")
+	authTimeout  = flag.Duration("auth_timeout", onedrive.DefaultAuthTimeout, "how long to wait for the browser to sign in")
+	localFolder  = flag.String("local", "", "path of a local folder to synchronize")
+	remoteFolder = flag.String("remote", "", "path of the destination remote folder")
+	endpoint     = flag.String("endpoint", "onedrive", "API endpoint: onedrive, graph or a base URL (graph by default with -client_id)")
+	driveSpec    = flag.String("drive", "default", "drive to back up to: default, me, id:<drive id>, user:<upn|id> or site:<site id>")
+	jsonOutput   = flag.Bool("json", false, "print command output as JSON")
+	appFolder    = flag.Bool("app_folder", false, "only access the app folder, remote paths are relative to it")
+	appOnly      = flag.Bool("app_only", false, "authenticate as the app of -client_id in -tenant without signing in, with -certificate or $"+clientSecretEnv)
+	certificate  = flag.String("certificate", "", "PEM file with the certificate and private key of the app, for -app_only")
+	ignoreQuota  = flag.Bool("ignore_quota", false, "upload even if the files don't fit in the remaining space")
+	overwrite    = flag.Bool("overwrite", false, "replace remote files whose contents differ, unless they change during the upload")
+	tokenKeyFile = flag.String("token_key_file", "", "file with the key to encrypt cached tokens with, instead of $"+passphraseEnv)
+	profileName  = flag.String("profile", DefaultProfile, "named profile with its own account, drive and remote folder")
+	homeDir      = flag.String("home", os.Getenv(onedrive.HomeEnv), "folder to keep configuration, caches and state in, instead of the XDG base directories and $"+onedrive.HomeEnv)
+	profilesFile = flag.String("profiles", "", "JSON file that configures the profiles (default profiles.json in the configuration folder)")
+	thumbCache   = flag.String("thumbnail_cache", "", "folder to cache thumbnails in (default thumbnails in the cache folder)")
+	logToFile    = flag.Bool("log", false, "also append the log to cloud-backup.log in the state folder")
+)
+
+const usage = `usage: cloud-backup [flags] [command] [arguments]
+
+Flags may also follow the command and its arguments, and "--" ends them.
+
+Commands:
+  push                    upload new local files to the remote folder, the default
+  pull                    download new remote files into the local folder
+  status                  show which local files need to be uploaded
+  verify                  compare the local and remote folders
+  ls [path]               list a remote folder, the remote folder by default
+  quota                   show how much space is used and available
+  auth login|logout|status
+                          sign the profile in or out, or show who is signed in
+  profiles                list the profiles and who they are signed in as
+  share link|list|revoke  manage sharing links
+  search <query>          search the remote folder
+  thumbnails <folder> [small|medium|large]
+                          cache the thumbnails of a remote folder
+
+Exit codes:
+  0  success
+  1  the command failed
+  2  the command or its arguments are wrong
+  3  files are not synchronized: after conflicts, failed transfers or an
+     interruption, or differences found by verify
+
+Flags:
+`
+
+// the exit codes, see usage
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitUsage      = 2
+	exitIncomplete = 3
+)
+
+// ERR_INCOMPLETE is returned by commands that ran, but left files that are
+// not synchronized
+var ERR_INCOMPLETE error = fmt.Errorf("Not all files are synchronized")
+
+// usageError is returned for an unknown command or wrong arguments, and is
+// the usage of the command
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// ExitCode returns the exit code for the error a command returned
+func ExitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, ERR_INCOMPLETE):
+		return exitIncomplete
+	}
+	return exitError
+}
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	command, args, _ := ParseCommandLine(flag.CommandLine, os.Args[1:])
+	dirs, err := onedrive.UserDirs(*homeDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *profilesFile == "" {
+		*profilesFile = filepath.Join(dirs.Config, "profiles.json")
+	}
+	if *thumbCache == "" {
+		*thumbCache = dirs.Thumbnails()
+	}
+	if *logToFile {
+		if err := appendLog(dirs.Logs()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	passphrase, err := tokenPassphrase(*tokenKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokenOptions = onedrive.Options{Home: *homeDir, Passphrase: passphrase, AuthTimeout: *authTimeout}
+	uploadsDir = dirs.Uploads()
+	hashesDir = dirs.Hashes()
+
+	// cancel the run on the first interrupt, a second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	profiles, err := LoadProfiles(*profilesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	profile, err := profiles.Get(*profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	explicit := explicitFlags()
+	profile = resolveProfile(profile, explicit)
+
+	err = run(ctx, command, args, profiles, profile, explicit)
+	if err != nil {
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			log.Print(err)
+		}
+	}
+	os.Exit(ExitCode(err))
+}
+
+// ParseCommandLine parses the flags, which may come before and after the
+// command and its arguments, and returns the command and its arguments.
+// Everything after "--" is an argument. Without a command the local folder
+// is backed up with push.
+func ParseCommandLine(flags *flag.FlagSet, arguments []string) (string, []string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(arguments); err != nil {
+			return "", nil, err
+		}
+		consumed := len(arguments) - flags.NArg()
+		if consumed > 0 && arguments[consumed-1] == "--" {
+			positional = append(positional, flags.Args()...)
+			break
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		arguments = flags.Args()[1:]
+	}
+
+	if len(positional) == 0 {
+		return "push", nil, nil
+	}
+	return positional[0], positional[1:], nil
+}
+
+// run runs the command for the profile
+func run(ctx context.Context, command string, args []string, profiles Profiles, profile *Profile, explicit map[string]bool) error {
+	// profiles are listed without signing in to any of them, and the auth
+	// command signs in and out itself
+	switch command {
+	case "profiles":
+		return listProfiles(ctx, profiles, explicit, os.Stdout, *jsonOutput)
+	case "auth":
+		return auth(ctx, profile, args, os.Stdout, *jsonOutput)
+	}
+
+	switch command {
+	case "push", "pull", "status", "verify", "ls", "quota", "share", "search", "thumbnails":
+	default:
+		return usageError(fmt.Sprintf("Unknown command %q, see -help", command))
+	}
+	api, err := connect(ctx, profile, true)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "ls":
+		return ls(ctx, api, args, profile.Remote, os.Stdout, *jsonOutput)
+	case "quota":
+		return quota(ctx, api, args, os.Stdout, *jsonOutput)
+	case "share":
+		return share(ctx, api, args, os.Stdout, *jsonOutput)
+	case "search":
+		return search(ctx, api, args, profile.Remote, os.Stdout, *jsonOutput)
+	case "thumbnails":
+		return thumbnails(ctx, api, args, *thumbCache, os.Stdout, *jsonOutput)
+	}
+
+	// the remaining commands synchronize the local and remote folders
+	if len(args) > 0 {
+		return usageError(fmt.Sprintf("usage: %s, with the folders given by -local and -remote", command))
+	}
+	remote, err := connectRemote(ctx, api, profile)
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "push":
+		return push(ctx, remote, profile)
+	case "pull":
+		return pull(ctx, remote, profile)
+	case "status":
+		return status(remote, profile, os.Stdout, *jsonOutput)
+	}
+	return verify(remote, profile, os.Stdout, *jsonOutput)
+}
+
+// connectRemote returns the remote file system of the profile, and logs the
+// drive it is on
+func connectRemote(ctx context.Context, api *onedrive.OneDriveAPI, profile *Profile) (*OneDriveFilesystem, error) {
+	remote, err := NewOneDriveFilesystem(ctx, api)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching quota: %w", err)
+	}
+	owner := "unknown"
+	if remote.Drive.Owner != nil && remote.Drive.Owner.User != nil {
+		owner = remote.Drive.Owner.User.DisplayName
+	}
+	// drives without a quota facet have no limit that is known
+	space := "no quota"
+	if quota := remote.Drive.Quota; quota != nil {
+		space = fmt.Sprintf("%s of %s available, quota %s",
+			humanize.Bytes(uint64(quota.Remaining)), humanize.Bytes(uint64(quota.Total)), quota.State)
+	}
+	log.Printf("Connected to %s's %s drive (%s)", owner, remote.Drive.DriveType, space)
+	if profile.AppFolder {
+		item, err := api.AppFolderContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching app folder: %w", err)
+		}
+		log.Printf("Using app folder %s (%s)", item.Name, item.Id)
+	}
+	return remote, nil
+}
+
+// explicitFlags returns the names of the flags set on the command line
+func explicitFlags() map[string]bool {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+// resolveProfile returns the settings of the profile, where flags that were
+// set explicitly take precedence and flags that weren't provide the defaults.
+func resolveProfile(profile *Profile, explicit map[string]bool) *Profile {
+	resolved := *profile
+	choose := func(name string, value *string, flagValue string) {
+		if explicit[name] || *value == "" {
+			*value = flagValue
+		}
+	}
+	choose("secret_file", &resolved.SecretFile, *secretFile)
+	choose("client_id", &resolved.ClientID, *clientID)
+	if resolved.ClientID == "" {
+		resolved.ClientID = os.Getenv(clientIDEnv)
+	}
+	choose("tenant", &resolved.Tenant, *tenant)
+	choose("endpoint", &resolved.Endpoint, *endpoint)
+	if resolved.ClientID != "" && profile.Endpoint == "" && !explicit["endpoint"] {
+		// apps registered with the identity platform can only use Graph
+		resolved.Endpoint = "graph"
+	}
+	choose("drive", &resolved.Drive, *driveSpec)
+	choose("remote", &resolved.Remote, *remoteFolder)
+	choose("local", &resolved.Local, *localFolder)
+	choose("certificate", &resolved.Certificate, *certificate)
+	if explicit["app_folder"] || !resolved.AppFolder {
+		resolved.AppFolder = *appFolder
+	}
+	if explicit["app_only"] || !resolved.AppOnly {
+		resolved.AppOnly = *appOnly
+	}
+	return &resolved
+}
+
+// connect returns a client for the drive of the profile. Unless interactive,
+// it fails instead of signing in when the profile has no cached token.
+func connect(ctx context.Context, profile *Profile, interactive bool) (*onedrive.OneDriveAPI, error) {
+	if profile.AppOnly {
+		return connectApp(ctx, profile)
+	}
+	baseURL, drive, config, opts, err := profileConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	if !interactive {
+		client, err := onedrive.CachedOAuthClient(profile.AppName(), config, opts)
+		if err != nil {
+			return nil, err
+		}
+		return profileAPI(profile, client, baseURL, drive), nil
+	}
+	client, err := onedrive.OAuthClient(ctx, profile.AppName(), config, opts)
+	if err != nil {
+		return nil, err
+	}
+	return profileAPI(profile, client, baseURL, drive), nil
+}
+
+// connectApp returns a client for the drive of an app-only profile, which
+// authenticates as the app itself rather than a signed in user.
+func connectApp(ctx context.Context, profile *Profile) (*onedrive.OneDriveAPI, error) {
+	baseURL, drive, creds, scopes, err := appConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	client, err := onedrive.AppClient(ctx, profile.AppName(), creds, scopes, tokenOptions)
+	if err != nil {
+		return nil, err
+	}
+	return profileAPI(profile, client, baseURL, drive), nil
+}
+
+// appConfig returns the base URL, drive, credentials and scopes of an
+// app-only profile.
+func appConfig(profile *Profile) (string, string, *onedrive.AppCredentials, []string, error) {
+	baseURL, err := onedrive.ParseEndpoint(profile.Endpoint)
+	if err != nil {
+		return "", "", nil, nil, err
+	}
+	drive, err := onedrive.ParseDrive(profile.Drive)
+	if err != nil {
+		return "", "", nil, nil, err
+	}
+	if drive == onedrive.DefaultDrive || drive == "/me/drive" || profile.AppFolder {
+		return "", "", nil, nil, errors.New("Without a signed in user, the drive must be given as user:<user>, id:<drive id> or site:<site id>")
+	}
+	scopes, err := onedrive.AppScopes(baseURL)
+	if err != nil {
+		return "", "", nil, nil, err
+	}
+
+	creds := &onedrive.AppCredentials{
+		Tenant:   profile.Tenant,
+		ClientID: profile.ClientID,
+		Secret:   os.Getenv(clientSecretEnv),
+	}
+	if profile.Certificate != "" {
+		creds.Certificate, creds.Key, err = onedrive.LoadCertificate(profile.Certificate)
+		if err != nil {
+			return "", "", nil, nil, err
+		}
+	}
+	return baseURL, drive, creds, scopes, nil
+}
+
+// profileConfig returns the base URL, drive, OAuth configuration and token
+// options of the profile. The app folder needs narrower scopes, which are
+// granted separately.
+func profileConfig(profile *Profile) (string, string, *oauth2.Config, onedrive.Options, error) {
+	baseURL, err := onedrive.ParseEndpoint(profile.Endpoint)
+	if err != nil {
+		return "", "", nil, tokenOptions, err
+	}
+	drive, err := onedrive.ParseDrive(profile.Drive)
+	if err != nil {
+		return "", "", nil, tokenOptions, err
+	}
+	scopes := onedrive.DefaultScopes(baseURL)
+	if profile.AppFolder {
+		scopes = onedrive.AppFolderScopes(baseURL)
+	}
+	config, opts, err := oauthConfig(profile, scopes)
+	if err != nil {
+		return "", "", nil, opts, err
+	}
+	return baseURL, drive, config, opts, nil
+}
+
+// uploadsDir is where the upload sessions of all profiles are kept, so that
+// interrupted uploads of large files can be resumed
+var uploadsDir string
+
+// hashesDir is where the hashes of local files are cached, see HashCache
+var hashesDir string
+
+// profileAPI returns a client for the drive of the profile, which keeps its
+// upload sessions separate from those of other profiles
+func profileAPI(profile *Profile, client *http.Client, baseURL, drive string) *onedrive.OneDriveAPI {
+	var api *onedrive.OneDriveAPI
+	if profile.AppFolder {
+		api = onedrive.NewAppFolderAPI(client, baseURL, drive)
+	} else {
+		api = onedrive.NewOneDriveAPI(client, baseURL, drive)
+	}
+	if uploadsDir != "" {
+		api.SetUploadStateDir(filepath.Join(uploadsDir, profile.AppName()))
+	}
+	return api
+}
+
+// the environment variables with the application id, and the secret of apps
+// that authenticate without a signed in user
+const (
+	clientIDEnv     = "CLOUD_BACKUP_CLIENT_ID"
+	clientSecretEnv = "CLOUD_BACKUP_CLIENT_SECRET"
+)
+
+// oauthConfig returns the OAuth configuration of the profile, and the token
+// options with its sign in and revocation endpoints. With a client id, the
+// Microsoft identity platform endpoints of the tenant are used as a public
+// client, otherwise the configuration is read from the secrets file.
+func oauthConfig(profile *Profile, scopes []string) (*oauth2.Config, onedrive.Options, error) {
+	opts := tokenOptions
+	if profile.ClientID == "" {
+		secrets, err := onedrive.ReadClientSecrets(profile.SecretFile)
+		if err != nil {
+			return nil, opts, err
+		}
+		if *deviceCode {
+			// the device code has to be redeemed at the same token endpoint
+			opts.DeviceAuthURL, err = secrets.DeviceAuthURL()
+			if err != nil {
+				return nil, opts, err
+			}
+		}
+		opts.RevokeURL = secrets.Installed.Revoke_uri
+		config := secrets.Config(scopes)
+		config.RedirectURL = onedrive.RedirectURL(*redirectHost, *redirectPort)
+		return config, opts, nil
+	}
+	config, err := onedrive.MicrosoftConfig(profile.Tenant, profile.ClientID, "", scopes)
+	if err != nil {
+		return nil, opts, err
+	}
+	config.RedirectURL = onedrive.RedirectURL(*redirectHost, *redirectPort)
+	if *deviceCode {
+		opts.DeviceAuthURL, err = onedrive.MicrosoftDeviceEndpoint(profile.Tenant)
+		if err != nil {
+			return nil, opts, err
+		}
+	}
+	return config, opts, nil
+}
+
+// appendLog writes the log to cloud-backup.log in dir as well as stderr
+func appendLog(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "cloud-backup.log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	return nil
+}
+
+// tokenOptions are where tokens are cached and the passphrase they are
+// encrypted with, the same for all profiles
+var tokenOptions onedrive.Options
+
+// passphraseEnv is the environment variable with the token cache passphrase
+const passphraseEnv = "CLOUD_BACKUP_PASSPHRASE"
+
+// tokenPassphrase returns the secret to encrypt cached tokens with, which is
+// read from the key file if given and the environment otherwise. Without
+// either, tokens are not encrypted.
+func tokenPassphrase(keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = bytes.TrimSpace(key)
+		if len(key) == 0 {
+			return nil, fmt.Errorf("Key file %s is empty", keyFile)
+		}
+		return key, nil
+	}
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	return nil, nil
 }
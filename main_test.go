@@ -0,0 +1,59 @@
+package main_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jnwhiteh/cloud-backup"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	type testCase struct {
+		arguments string
+		command   string
+		args      []string
+		asJSON    bool
+		local     string
+	}
+
+	testCases := []testCase{
+		{"", "push", nil, false, ""},
+		{"-json status", "status", nil, true, ""},
+		{"status -json", "status", nil, true, ""},
+		{"-local pics push -json", "push", nil, true, "pics"},
+		{"ls -json Photos", "ls", []string{"Photos"}, true, ""},
+		{"share link a.jpg -local pics", "share", []string{"link", "a.jpg"}, false, "pics"},
+		{"ls -- -odd -json", "ls", []string{"-odd", "-json"}, false, ""},
+		{"-json -- status -local", "status", []string{"-local"}, true, ""},
+	}
+
+	for _, tc := range testCases {
+		flags := flag.NewFlagSet("cloud-backup", flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "")
+		local := flags.String("local", "", "")
+
+		command, args, err := main.ParseCommandLine(flags, strings.Fields(tc.arguments))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tc.arguments, err)
+			continue
+		}
+		if command != tc.command || len(args) != len(tc.args) || (len(args) > 0 && !reflect.DeepEqual(args, tc.args)) {
+			t.Errorf("%q: expected %s %q, got %s %q", tc.arguments, tc.command, tc.args, command, args)
+		}
+		if *asJSON != tc.asJSON || *local != tc.local {
+			t.Errorf("%q: expected -json=%t -local=%q, got -json=%t -local=%q", tc.arguments, tc.asJSON, tc.local, *asJSON, *local)
+		}
+	}
+
+	// unknown flags are errors wherever they are
+	for _, arguments := range []string{"-dry_run push", "push -dry_run"} {
+		flags := flag.NewFlagSet("cloud-backup", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		if _, _, err := main.ParseCommandLine(flags, strings.Fields(arguments)); err == nil {
+			t.Errorf("%q: expected an error for an unknown flag", arguments)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+// OneDriveFilesystem implements the Filer, Uploader and Downloader
+// interfaces for a drive on OneDrive
+type OneDriveFilesystem struct {
+	ctx   context.Context
+	api   *onedrive.OneDriveAPI
+	Drive *onedrive.Drive // the drive, as it was when connecting
+}
+
+// NewOneDriveFilesystem connects to the drive of the given client. All
+// requests are made with the given context, so cancelling it stops any
+// listing or upload in progress.
+func NewOneDriveFilesystem(ctx context.Context, api *onedrive.OneDriveAPI) (*OneDriveFilesystem, error) {
+	drive, err := api.QuotaContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OneDriveFilesystem{
+		ctx:   ctx,
+		api:   api,
+		Drive: drive,
+	}, nil
+}
+
+// Hasher returns a hash.Hash for local files that matches the hashes of most
+// remote files. Business drives and document libraries only provide a
+// QuickXorHash, and personal drives a SHA1 hash for most files.
+func (f *OneDriveFilesystem) Hasher() hash.Hash {
+	return f.hashType().New()
+}
+
+func (f *OneDriveFilesystem) hashType() onedrive.HashType {
+	if f.Drive.DriveType != "personal" {
+		return onedrive.HashQuickXor
+	}
+	return onedrive.HashSHA1
+}
+
+// LocalFilesystem returns a LocalFilesystem for local files that hashes them
+// with Hasher, and again with the type of hash of a remote file that has
+// another one, so that each can be compared with the remote file. The hashes
+// are cached in hashesDir, if it is set.
+func (f *OneDriveFilesystem) LocalFilesystem() LocalFilesystem {
+	local := NewLocalFilesystem(f.Hasher(), nil, nil)
+	local.SetHashTypes(string(f.hashType()), func(hashType string) hash.Hash {
+		return onedrive.HashType(hashType).New()
+	})
+	if hashesDir != "" {
+		local.SetHashCache(NewHashCache(hashesDir))
+	}
+	return local
+}
+
+func (f *OneDriveFilesystem) Files(folder string) ([]HashedFile, error) {
+	children, err := f.api.ChildHashesContext(f.ctx, folder)
+	if errors.Is(err, onedrive.PathNotFound) {
+		// a missing folder is simply empty, it's created on upload
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var results []HashedFile
+	for _, child := range children {
+		hash := child.Hash
+		if hash != "" && child.HashType == onedrive.HashQuickXor {
+			// convert the base64 QuickXorHash to hex like all other hashes
+			digest, err := base64.StdEncoding.DecodeString(hash)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid hash for %s: %w", child.Name, err)
+			}
+			hash = fmt.Sprintf("%x", digest)
+		}
+
+		results = append(results, HashedFile{
+			Folder:   folder,
+			Filename: child.Name,
+			Hash:     hash,
+			HashType: string(child.HashType),
+			Size:     child.Size,
+			Modified: child.Modified,
+			ETag:     child.ETag,
+		})
+	}
+	return results, nil
+}
+
+// Upload uploads the local file into the remote folder, creating the folder
+// if needed. A file without an eTag wasn't on the remote when it was listed,
+// and one with an eTag replaces the remote version it was listed with, so the
+// upload fails rather than overwrite a file that was created or changed
+// remotely since then, and ERR_CONFLICT is returned instead.
+func (f *OneDriveFilesystem) Upload(local HashedFile, remoteFolder string) error {
+	if _, err := f.api.EnsureFolderContext(f.ctx, remoteFolder); err != nil {
+		return err
+	}
+
+	_, err := f.api.UploadIfMatchContext(f.ctx, local.LocalPath(), local.RemotePath(remoteFolder), local.ETag)
+	if errors.Is(err, onedrive.Conflict) || errors.Is(err, onedrive.PreconditionFailed) {
+		return ERR_CONFLICT
+	}
+	return err
+}
+
+// Download downloads the remote file into the local folder. The contents are
+// checked against the remote hash, if there is one, before the file appears
+// under its name, and it keeps the remote modification time.
+func (f *OneDriveFilesystem) Download(remote HashedFile, localFolder string) error {
+	temp, err := ioutil.TempFile(localFolder, "."+remote.Filename+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	hasher := f.Hasher()
+	if remoteHasher := onedrive.HashType(remote.HashType).New(); remoteHasher != nil {
+		hasher = remoteHasher
+	}
+	err = f.api.DownloadContext(f.ctx, remote.RemotePath(remote.Folder), io.MultiWriter(temp, hasher))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if hash := fmt.Sprintf("%x", hasher.Sum(nil)); remote.Hash != "" && hash != remote.Hash {
+		return fmt.Errorf("Downloaded %s has hash %s, expected %s", remote.Filename, hash, remote.Hash)
+	}
+
+	if !remote.Modified.IsZero() {
+		if err := os.Chtimes(temp.Name(), remote.Modified, remote.Modified); err != nil {
+			return err
+		}
+	}
+	return os.Rename(temp.Name(), filepath.Join(localFolder, remote.Filename))
+}
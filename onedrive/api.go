@@ -1,63 +1,70 @@
-package main
+package onedrive
 
-//go:generate go run tools/generate.go resources
+//go:generate go run tools/generate.go -p onedrive -i resources
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"hash"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/dustin/go-humanize"
 )
 
-var (
-	PathNotFound = fmt.Errorf("PathNotFound")
-)
-
 type OneDriveAPI struct {
-	client  *http.Client
-	baseURL string
+	client       *http.Client
+	uploadClient *http.Client // for pre-authenticated upload URLs
+	baseURL      string
+	drive        string      // the path of the drive relative to baseURL, e.g. /drive
+	root         string      // the path of the root folder relative to drive
+	noBatch      atomic.Bool // set once the endpoint has rejected a $batch request
+	folders      folderCache // remote folders known to exist
+	uploadState  string      // the folder interrupted upload sessions are kept in, if any
 }
 
 func (api *OneDriveAPI) Quota() (*Drive, error) {
+	return api.QuotaContext(context.Background())
+}
+
+func (api *OneDriveAPI) QuotaContext(ctx context.Context) (*Drive, error) {
 	var response Drive
-	resp, err := api.client.Get(api.baseURL + "/drive")
+	err := api.getJSON(ctx, api.baseURL+api.drive, &response)
 	if err != nil {
 		return nil, err
 	}
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	return &response, err
+	return &response, nil
 }
 
 func (api *OneDriveAPI) Metadata(path string) (*Item, error) {
-	endpoint := &url.URL{
-		Path:     api.baseURL + "/drive/root:/" + path,
-		RawQuery: "select=id,folder,file",
-	}
-	resp, err := api.client.Get(endpoint.String())
+	return api.MetadataContext(context.Background(), path)
+}
+
+func (api *OneDriveAPI) MetadataContext(ctx context.Context, path string) (*Item, error) {
+	endpoint := api.endpoint(api.itemPath(path, ""), "$select=id,name,eTag,cTag,folder,file")
+
+	var response Item
+	err := api.getJSON(ctx, endpoint, &response)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == 404 {
-		return nil, PathNotFound
-	}
-
-	var response Item
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	return &response, err
+	return &response, nil
 }
 
 type FileHash struct {
-	Name string
-	Hash string
+	Name     string
+	Hash     string    // the hash of the contents, see remoteHash
+	HashType HashType  // the type of Hash, if there is one
+	ETag     string    // the eTag of the remote file when it was listed
+	Size     int64     // the size of the file in bytes
+	Modified time.Time // the modification time recorded by the file system
 }
 
 type ByName []FileHash
@@ -73,87 +80,197 @@ func (a ByName) Less(i, j int) bool {
 }
 
 func (api *OneDriveAPI) ChildHashes(folderPath string) ([]FileHash, error) {
-	endpoint := &url.URL{
-		Path:     api.baseURL + "/drive/root:/" + folderPath + ":/children",
-		RawQuery: "select=id,name,folder,file",
-	}
-	resp, err := api.client.Get(endpoint.String())
+	return api.ChildHashesContext(context.Background(), folderPath)
+}
+
+func (api *OneDriveAPI) ChildHashesContext(ctx context.Context, folderPath string) ([]FileHash, error) {
+	endpoint := api.endpoint(api.itemPath(folderPath, "children"), "$select=id,name,eTag,size,folder,file,fileSystemInfo")
+
+	var result []FileHash
+	err := api.listItems(ctx, endpoint, func(metadata *Item) {
+		// we skip subfolders
+		if metadata.Folder != nil {
+			return
+		}
+
+		hash := FileHash{
+			Name: metadata.Name,
+			ETag: metadata.ETag,
+			Size: int64(metadata.Size),
+		}
+		hash.Hash, hash.HashType = remoteHash(metadata)
+		if metadata.FileSystemInfo != nil {
+			hash.Modified = metadata.FileSystemInfo.LastModifiedDateTime
+		}
+		result = append(result, hash)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == 404 {
-		return nil, PathNotFound
-	}
+	return result, nil
+}
 
+// listItems fetches a collection of items and calls fn for each of them,
+// following @odata.nextLink until all pages have been fetched.
+func (api *OneDriveAPI) listItems(ctx context.Context, endpoint string, fn func(*Item)) error {
 	var response ViewChanges
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err := api.getJSON(ctx, endpoint, &response)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var result []FileHash
-	for response.Value != nil && len(response.Value) > 0 {
-		for _, metadata := range response.Value {
-			if metadata.Folder != nil {
-				log.Fatalf("Cannot handle subdirectories yet")
-			}
-
-			result = append(result, FileHash{
-				metadata.Name,
-				strings.ToLower(metadata.File.Hashes.Sha1Hash),
-			})
+	count := 0
+	for {
+		for _, item := range response.Value {
+			fn(item)
 		}
+		count += len(response.Value)
 
-		if response.Instanceodata_nextLink != "" {
-			var nextLink = response.Instanceodata_nextLink
-			log.Printf("Collected %d results, fetching next page: %s", len(result), nextLink)
-			resp, err := api.client.Get(nextLink)
-			if err != nil {
-				log.Fatalf("Failed when fetching %s: %s", nextLink, err)
-			}
-
-			response = ViewChanges{}
-			err = json.NewDecoder(resp.Body).Decode(&response)
-			if err != nil {
-				log.Fatalf("Failed decoding next page response: %s", err)
-			}
-		} else {
-			break
+		if response.Instanceodata_nextLink == "" {
+			return nil
+		}
+		var nextLink = response.Instanceodata_nextLink
+		log.Printf("Collected %d results, fetching next page: %s", count, nextLink)
+		response = ViewChanges{}
+		err := api.getJSON(ctx, nextLink, &response)
+		if err != nil {
+			return fmt.Errorf("Failed when fetching %s: %w", nextLink, err)
 		}
 	}
+}
 
-	return result, nil
+// HashType is the type of hash of a remote file
+type HashType string
+
+const (
+	HashSHA1     HashType = "sha1"     // a hex digest
+	HashQuickXor HashType = "quickXor" // a base64 digest
+)
+
+// New returns a hash.Hash computing this type of hash, or nil if the type is
+// not known
+func (t HashType) New() hash.Hash {
+	switch t {
+	case HashSHA1:
+		return sha1.New()
+	case HashQuickXor:
+		return NewQuickXorHash()
+	}
+	return nil
+}
+
+// remoteHash returns the hash of a remote file and its type, which is the hex
+// SHA1 hash if there is one or else the base64 QuickXorHash. Business drives
+// only have the latter, and personal drives may have either.
+func remoteHash(item *Item) (string, HashType) {
+	if item.File == nil || item.File.Hashes == nil {
+		return "", ""
+	} else if item.File.Hashes.Sha1Hash != "" {
+		return strings.ToLower(item.File.Hashes.Sha1Hash), HashSHA1
+	} else if item.File.Hashes.QuickXorHash != "" {
+		return item.File.Hashes.QuickXorHash, HashQuickXor
+	}
+	return "", ""
+}
+
+// getJSON fetches the given URL and decodes the JSON response into v
+func (api *OneDriveAPI) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	return api.doJSON(req, v)
+}
+
+// doJSON sends the request and decodes a successful JSON response into v.
+// Unsuccessful responses are returned as an *Error.
+func (api *OneDriveAPI) doJSON(req *http.Request, v interface{}) error {
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (api *OneDriveAPI) Upload(filename, remotePath string) (*Item, error) {
+	return api.UploadContext(context.Background(), filename, remotePath)
+}
+
+// UploadContext uploads the local file to remotePath, replacing any existing
+// file. If the context is cancelled the upload is aborted, both by the request
+// and the body reader.
+func (api *OneDriveAPI) UploadContext(ctx context.Context, filename, remotePath string) (*Item, error) {
+	return api.upload(ctx, filename, remotePath, "", false)
 }
 
-func (api *OneDriveAPI) Upload(filename, remotePath string) (string, error) {
+func (api *OneDriveAPI) UploadIfMatch(filename, remotePath, eTag string) (*Item, error) {
+	return api.UploadIfMatchContext(context.Background(), filename, remotePath, eTag)
+}
+
+// UploadIfMatchContext uploads the local file to remotePath only if the remote
+// file is unchanged since it was observed with the given eTag, and fails with
+// PreconditionFailed otherwise. An empty eTag means the file did not exist,
+// and the upload fails with Conflict if it has been created since.
+func (api *OneDriveAPI) UploadIfMatchContext(ctx context.Context, filename, remotePath, eTag string) (*Item, error) {
+	return api.upload(ctx, filename, remotePath, eTag, eTag == "")
+}
+
+// upload sends the file in a single request, or in an upload session if it is
+// too large for that, and records the local timestamps of the file.
+func (api *OneDriveAPI) upload(ctx context.Context, filename, remotePath, eTag string, failIfExists bool) (*Item, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	info := localFileSystemInfo(stat)
 
-	endpoint := &url.URL{
-		Path: api.baseURL + "/drive/root:/" + remotePath + ":/content",
+	sreader := &SpeedReader{ctx: ctx, file: file, start: time.Now()}
+	if stat.Size() > simpleUploadLimit {
+		defer sreader.Close()
+		return api.uploadSession(ctx, sreader, filename, stat, remotePath, info, eTag, failIfExists)
 	}
-	sreader := &SpeedReader{file: file, start: time.Now()}
 
-	req, err := http.NewRequest("PUT", endpoint.String(), sreader)
+	query := ""
+	if failIfExists {
+		query = api.conflictBehavior() + "=fail"
+	}
+	endpoint := api.endpoint(api.itemPath(remotePath, "content"), query)
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, sreader)
 	if err != nil {
-		return "", err
+		sreader.Close()
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
-	resp, err := api.client.Do(req)
+	if eTag != "" {
+		req.Header.Set("If-Match", eTag)
+	}
+
+	var response Item
+	err = api.doJSON(req, &response)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	// a simple upload can't carry any metadata, so set it afterwards
+	item, err := api.setFileSystemInfo(ctx, remotePath, response.ETag, info)
 	if err != nil {
-		return "", err
+		log.Printf("Warning: failed to set timestamps of %s: %s", remotePath, err)
+		return &response, nil
 	}
-	return fmt.Sprintf("%s", body), nil
+	return item, nil
 }
 
 type SpeedReader struct {
+	ctx   context.Context
 	file  *os.File
 	start time.Time
 	bytes uint64
@@ -161,6 +278,11 @@ type SpeedReader struct {
 }
 
 func (r *SpeedReader) Read(p []byte) (int, error) {
+	if r.ctx != nil {
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
 	n, err := r.file.Read(p)
 	r.bytes += uint64(n)
 	duration := uint64(time.Now().Sub(r.start).Seconds())
@@ -170,27 +292,96 @@ func (r *SpeedReader) Read(p []byte) (int, error) {
 	}
 	return n, err
 }
+
+// Seek moves to the given position in the file, e.g. to resume an upload
+func (r *SpeedReader) Seek(offset int64, whence int) (int64, error) {
+	return r.file.Seek(offset, whence)
+}
+
 func (r *SpeedReader) Close() error {
 	return r.file.Close()
 }
 
-func (api *OneDriveAPI) Mkdir(parent, name string) (string, error) {
-	endpoint := &url.URL{
-		Path: api.baseURL + "/drive/root:/" + parent + ":/children",
+// newFolder returns the body of a request that creates the named folder. An
+// existing folder with the same name fails the request with Conflict, rather
+// than the new one being renamed.
+func (api *OneDriveAPI) newFolder(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                 name,
+		"folder":               struct{}{},
+		api.conflictBehavior(): "fail",
 	}
-	type folderPayload struct {
-		Name   string   `json:"name"`
-		Folder struct{} `json:"folder"`
+}
+
+func (api *OneDriveAPI) Mkdir(parent, name string) (*Item, error) {
+	return api.MkdirContext(context.Background(), parent, name)
+}
+
+func (api *OneDriveAPI) MkdirContext(ctx context.Context, parent, name string) (*Item, error) {
+	endpoint := api.endpoint(api.itemPath(parent, "children"), "")
+	body := getIndentedJSON(api.newFolder(name))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
 	}
-	payload := folderPayload{Name: name}
-	body := getIndentedJSON(payload)
-	resp, err := api.client.Post(endpoint.String(), "application/json", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	var response Item
+	err = api.doJSON(req, &response)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	body, err = ioutil.ReadAll(resp.Body)
+	return &response, nil
+}
+
+func (api *OneDriveAPI) Rename(path, name, eTag string) (*Item, error) {
+	return api.RenameContext(context.Background(), path, name, eTag)
+}
+
+// RenameContext renames the item at path. If eTag is not empty the rename
+// fails with PreconditionFailed when the item has changed since it was
+// observed with that eTag.
+func (api *OneDriveAPI) RenameContext(ctx context.Context, path, name, eTag string) (*Item, error) {
+	endpoint := api.endpoint(api.itemPath(path, ""), "")
+	body := getIndentedJSON(map[string]string{"name": name})
+	req, err := http.NewRequestWithContext(ctx, "PATCH", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if eTag != "" {
+		req.Header.Set("If-Match", eTag)
+	}
+
+	var response Item
+	err = api.doJSON(req, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (api *OneDriveAPI) Delete(path, eTag string) error {
+	return api.DeleteContext(context.Background(), path, eTag)
+}
+
+// DeleteContext moves the item at path to the recycle bin. If eTag is not
+// empty the delete fails with PreconditionFailed when the item has changed
+// since it was observed with that eTag.
+func (api *OneDriveAPI) DeleteContext(ctx context.Context, path, eTag string) error {
+	endpoint := api.endpoint(api.itemPath(path, ""), "")
+	req, err := http.NewRequestWithContext(ctx, "DELETE", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if eTag != "" {
+		req.Header.Set("If-Match", eTag)
+	}
+
+	resp, err := api.client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return fmt.Sprintf("%s", body), nil
+	defer resp.Body.Close()
+	return checkResponse(resp)
 }
@@ -0,0 +1,106 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContextCancelled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprint(rw, `{"id": "drive"}`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+	_, err := api.QuotaContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected no requests to be sent, got %d", requests)
+	}
+}
+
+func TestSpeedReaderCancelled(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filename, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &SpeedReader{ctx: ctx, file: file, start: time.Now()}
+	defer reader.Close()
+
+	buf := make([]byte, 4)
+	if n, err := reader.Read(buf); n != 4 || err != nil {
+		t.Fatalf("expected to read 4 bytes, got %d (%v)", n, err)
+	}
+	cancel()
+	if n, err := reader.Read(buf); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled read, got %d (%v)", n, err)
+	}
+}
+
+func TestUploadIfMatch(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	local := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(local, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new file is only created if nobody else created it in the meantime
+	first, err := api.UploadIfMatch(local, "photo.jpg", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := api.UploadIfMatch(local, "photo.jpg", ""); !errors.Is(err, Conflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+
+	// an existing file is only replaced if it has not changed
+	second, err := api.UploadIfMatch(local, "photo.jpg", first.ETag)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := api.UploadIfMatch(local, "photo.jpg", first.ETag); !errors.Is(err, PreconditionFailed) {
+		t.Fatalf("expected a failed precondition, got %v", err)
+	}
+
+	if _, err := api.Rename("photo.jpg", "renamed.jpg", first.ETag); !errors.Is(err, PreconditionFailed) {
+		t.Fatalf("expected a failed precondition, got %v", err)
+	}
+	renamed, err := api.Rename("photo.jpg", "renamed.jpg", second.ETag)
+	if err != nil || renamed.Name != "renamed.jpg" {
+		t.Fatalf("expected the file to be renamed, got %v", err)
+	}
+
+	if err := api.Delete("renamed.jpg", second.ETag); !errors.Is(err, PreconditionFailed) {
+		t.Fatalf("expected a failed precondition, got %v", err)
+	}
+	if err := api.Delete("renamed.jpg", renamed.ETag); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := drive.items["renamed.jpg"]; ok {
+		t.Errorf("expected the file to be deleted")
+	}
+}
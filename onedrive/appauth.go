@@ -0,0 +1,255 @@
+package onedrive
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// AppCredentials authenticate an application as itself rather than on
+// behalf of a signed in user, with the client credentials grant. Apps
+// authenticate with either a client secret or a certificate, and can only
+// address drives by id, user or site.
+type AppCredentials struct {
+	Tenant      string // a tenant id or domain, not common
+	ClientID    string
+	Secret      string
+	Certificate *x509.Certificate // and its Key, instead of a secret
+	Key         *rsa.PrivateKey
+
+	// TokenURL defaults to the token endpoint of the tenant
+	TokenURL string
+}
+
+// AppScopes returns the scope an app is granted on the given endpoint, which
+// are the application permissions configured for it. The OneDrive API only
+// supports signed in users.
+func AppScopes(baseURL string) ([]string, error) {
+	if baseURL == OneDriveBaseURL {
+		return nil, errors.New("The OneDrive API doesn't support apps without a signed in user, use Microsoft Graph")
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return []string{parsed.Scheme + "://" + parsed.Host + "/.default"}, nil
+}
+
+// LoadCertificate reads a certificate and its RSA private key from a PEM
+// file with both.
+func LoadCertificate(filename string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cert *x509.Certificate
+	var key *rsa.PrivateKey
+	for block, rest := pem.Decode(contents); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert == nil {
+				cert, err = x509.ParseCertificate(block.Bytes)
+			}
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			var parsed interface{}
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			if rsaKey, ok := parsed.(*rsa.PrivateKey); ok {
+				key = rsaKey
+			} else if err == nil {
+				err = errors.New("only RSA keys are supported")
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid %s in %s: %w", strings.ToLower(block.Type), filename, err)
+		}
+	}
+	if cert == nil || key == nil {
+		return nil, nil, fmt.Errorf("%s needs both a certificate and its private key", filename)
+	}
+	return cert, key, nil
+}
+
+// validate checks that the credentials are complete and returns the token
+// endpoint.
+func (c *AppCredentials) validate() (string, error) {
+	if c.ClientID == "" {
+		return "", errors.New("No client id, apps need the application id they are registered with")
+	}
+	if c.Secret == "" && (c.Certificate == nil || c.Key == nil) {
+		return "", errors.New("Apps need a client secret or a certificate")
+	}
+	if c.TokenURL != "" {
+		return c.TokenURL, nil
+	}
+	switch c.Tenant {
+	case CommonTenant, ConsumersTenant, OrganizationsTenant:
+		return "", fmt.Errorf("Apps need a tenant id or domain, not %q", c.Tenant)
+	}
+	endpoint, err := MicrosoftEndpoint(c.Tenant)
+	return endpoint.TokenURL, err
+}
+
+// cacheConfig returns the configuration the token cache is named after
+func (c *AppCredentials) cacheConfig(scopes []string) *oauth2.Config {
+	secret := c.Secret
+	if c.Certificate != nil {
+		secret = thumbprint(c.Certificate)
+	}
+	return &oauth2.Config{ClientID: c.ClientID, ClientSecret: secret, Scopes: scopes}
+}
+
+// thumbprint returns the base64url encoded SHA-1 hash of the certificate,
+// which identifies it to the Microsoft identity platform
+func thumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// assertion returns a client assertion signed with the certificate's key,
+// which is valid for a few minutes.
+func (c *AppCredentials) assertion(tokenURL string, now time.Time) (string, error) {
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": thumbprint(c.Certificate),
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": tokenURL,
+		"iss": c.ClientID,
+		"sub": c.ClientID,
+		"jti": jti,
+		"nbf": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appTokenSource requests a new token with the client credentials grant
+// every time, so it's wrapped in a reusing token source.
+type appTokenSource struct {
+	ctx      context.Context
+	client   *http.Client
+	creds    *AppCredentials
+	tokenURL string
+	scopes   []string
+}
+
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {s.creds.ClientID},
+		"scope":      {strings.Join(s.scopes, " ")},
+	}
+	if s.creds.Certificate != nil {
+		assertion, err := s.creds.assertion(s.tokenURL, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	} else {
+		form.Set("client_secret", s.creds.Secret)
+	}
+
+	var response tokenResponse
+	if err := postForm(s.ctx, s.client, s.tokenURL, form, &response); err != nil {
+		return nil, fmt.Errorf("Requesting app token failed: %w", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("Requesting app token failed: %s %s", response.Error, response.ErrorDescription)
+	}
+	if response.AccessToken == "" {
+		return nil, errors.New("Requesting app token failed: no access token in response")
+	}
+	token := &oauth2.Token{AccessToken: response.AccessToken, TokenType: response.TokenType}
+	if response.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// AppTokenSource returns a TokenSource for the app, which requests a new
+// token whenever the previous one expires. Tokens are requested with the
+// given context and client.
+func AppTokenSource(ctx context.Context, client *http.Client, creds *AppCredentials, scopes []string) (oauth2.TokenSource, error) {
+	tokenURL, err := creds.validate()
+	if err != nil {
+		return nil, err
+	}
+	source := &appTokenSource{ctx: ctx, client: client, creds: creds, tokenURL: tokenURL, scopes: scopes}
+	return oauth2.ReuseTokenSource(nil, source), nil
+}
+
+// AppClient creates a client authenticated as the app. Its tokens are cached
+// like those of OAuthClient, so a token that hasn't expired yet is reused by
+// the next run.
+func AppClient(ctx context.Context, appName string, creds *AppCredentials, scopes []string, opts Options) (*http.Client, error) {
+	tokenURL, err := creds.validate()
+	if err != nil {
+		return nil, err
+	}
+	cacheFile, err := tokenCacheFilename(appName, creds.cacheConfig(scopes), opts.Home)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := tokenFromFile(cacheFile, opts.Passphrase)
+	if errors.Is(err, ErrTokenEncrypted) {
+		return nil, fmt.Errorf("Error reading %q: %w", cacheFile, err)
+	} else if err != nil {
+		cached = nil
+	}
+
+	source := &appTokenSource{ctx: ctx, client: http.DefaultClient, creds: creds, tokenURL: tokenURL, scopes: scopes}
+	persisting := NewPersistingTokenSource(oauth2.ReuseTokenSource(cached, source), cacheFile, cached, opts)
+	if _, err := persisting.Token(); err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(ctx, persisting), nil
+}
+
+// AppTokenStatus describes the cached token of the app like
+// CachedTokenStatus, without requesting one.
+func AppTokenStatus(appName string, creds *AppCredentials, scopes []string, opts Options) (*TokenStatus, error) {
+	if _, err := creds.validate(); err != nil {
+		return nil, err
+	}
+	return CachedTokenStatus(appName, creds.cacheConfig(scopes), opts)
+}
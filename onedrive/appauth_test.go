@@ -0,0 +1,231 @@
+package onedrive
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAppTokenServer issues tokens for the client credentials grant to an
+// app with either the secret or the certificate
+type fakeAppTokenServer struct {
+	t        *testing.T
+	url      string
+	secret   string
+	cert     *x509.Certificate
+	expires  int
+	requests int
+}
+
+func (s *fakeAppTokenServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.FormValue("grant_type") != "client_credentials" || req.FormValue("client_id") != "app" ||
+		req.FormValue("scope") != "https://graph.microsoft.com/.default" {
+		rw.WriteHeader(400)
+		fmt.Fprint(rw, `{"error":"invalid_request"}`)
+		return
+	}
+	if req.FormValue("client_secret") != s.secret && !s.validAssertion(req.FormValue("client_assertion")) {
+		rw.WriteHeader(401)
+		fmt.Fprint(rw, `{"error":"invalid_client","error_description":"bad credentials"}`)
+		return
+	}
+	s.requests++
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"access_token": fmt.Sprintf("app%d", s.requests),
+		"token_type":   "Bearer",
+		"expires_in":   s.expires,
+	})
+}
+
+// validAssertion verifies the signature and claims of a client assertion
+func (s *fakeAppTokenServer) validAssertion(assertion string) bool {
+	parts := strings.Split(assertion, ".")
+	if s.cert == nil || len(parts) != 3 {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(s.cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+		s.t.Errorf("invalid assertion signature: %v", err)
+		return false
+	}
+
+	var header, claims map[string]interface{}
+	decoded, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	json.Unmarshal(decoded, &header)
+	decoded, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(decoded, &claims)
+	if header["x5t"] != thumbprint(s.cert) || claims["aud"] != s.url || claims["iss"] != "app" || claims["sub"] != "app" {
+		s.t.Errorf("unexpected assertion %v %v", header, claims)
+		return false
+	}
+	return true
+}
+
+// testCertificate creates a self-signed certificate
+func testCertificate(t *testing.T) (*x509.Certificate, *rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cloud-backup"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...)
+	return cert, key, contents
+}
+
+func TestAppClient(t *testing.T) {
+	opts := Options{Home: t.TempDir()}
+
+	tokens := &fakeAppTokenServer{t: t, secret: "secret", expires: 3600}
+	server := httptest.NewServer(tokens)
+	defer server.Close()
+	tokens.url = server.URL
+
+	scopes, err := AppScopes(GraphBaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := &AppCredentials{ClientID: "app", Secret: "secret", TokenURL: server.URL}
+	if _, err := AppClient(context.Background(), "test", creds, scopes, opts); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.requests != 1 {
+		t.Errorf("expected a token request, got %d", tokens.requests)
+	}
+
+	// the cached token is reused until it expires
+	if _, err := AppClient(context.Background(), "test", creds, scopes, opts); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.requests != 1 {
+		t.Errorf("expected the cached token to be used, got %d requests", tokens.requests)
+	}
+
+	// and its status is read from the cache
+	status, err := AppTokenStatus("test", creds, scopes, opts)
+	if err != nil || !status.SignedIn || status.Expiry.Before(time.Now()) || tokens.requests != 1 {
+		t.Errorf("expected the status of the cached token without a request, got %+v (%v)", status, err)
+	}
+	if status, err := AppTokenStatus("other", creds, scopes, opts); err != nil || status.SignedIn {
+		t.Errorf("expected no cached token for another app, got %+v (%v)", status, err)
+	}
+
+	// expired tokens are replaced, which is checked on every request
+	tokens.expires = 1
+	source, err := AppTokenSource(context.Background(), http.DefaultClient, creds, scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := source.Token()
+	if err != nil || first.AccessToken == second.AccessToken {
+		t.Errorf("expected a new token for an expired one, got %v and %v (%v)", first, second, err)
+	}
+
+	creds.Secret = "wrong"
+	if _, err := AppClient(context.Background(), "other", creds, scopes, opts); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("expected the token request to fail, got %v", err)
+	}
+}
+
+func TestAppCertificate(t *testing.T) {
+	opts := Options{Home: t.TempDir()}
+
+	cert, _, contents := testCertificate(t)
+	filename := filepath.Join(t.TempDir(), "app.pem")
+	if err := ioutil.WriteFile(filename, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, key, err := LoadCertificate(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(cert) {
+		t.Errorf("loaded the wrong certificate")
+	}
+
+	tokens := &fakeAppTokenServer{t: t, cert: cert, expires: 3600}
+	server := httptest.NewServer(tokens)
+	defer server.Close()
+	tokens.url = server.URL
+
+	creds := &AppCredentials{ClientID: "app", Certificate: loaded, Key: key, TokenURL: server.URL}
+	if _, err := AppClient(context.Background(), "test", creds, []string{"https://graph.microsoft.com/.default"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.requests != 1 {
+		t.Errorf("expected a token request, got %d", tokens.requests)
+	}
+
+	// a certificate without its key is incomplete
+	ioutil.WriteFile(filename, contents[:strings.Index(string(contents), "-----BEGIN RSA")], 0600)
+	if _, _, err := LoadCertificate(filename); err == nil {
+		t.Errorf("expected an error without a private key")
+	}
+}
+
+func TestAppCredentials(t *testing.T) {
+	type testCase struct {
+		creds    AppCredentials
+		expected string
+		err      bool
+	}
+
+	testCases := []testCase{
+		testCase{AppCredentials{Tenant: "contoso.onmicrosoft.com", ClientID: "app", Secret: "s"}, "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/token", false},
+		testCase{AppCredentials{Tenant: "common", ClientID: "app", Secret: "s"}, "", true},
+		testCase{AppCredentials{Tenant: "contoso.onmicrosoft.com", Secret: "s"}, "", true},
+		testCase{AppCredentials{Tenant: "contoso.onmicrosoft.com", ClientID: "app"}, "", true},
+	}
+
+	for _, test := range testCases {
+		tokenURL, err := test.creds.validate()
+		if test.err && err == nil {
+			t.Errorf("%+v: expected an error, got %q", test.creds, tokenURL)
+		} else if !test.err && (err != nil || tokenURL != test.expected) {
+			t.Errorf("%+v: expected %q, got %q (%v)", test.creds, test.expected, tokenURL, err)
+		}
+	}
+
+	if _, err := AppScopes(OneDriveBaseURL); err == nil {
+		t.Errorf("expected an error for the OneDrive API")
+	}
+}
@@ -0,0 +1,134 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenStatus describes the cached token of an app
+type TokenStatus struct {
+	CacheFile   string    `json:"cache_file"`
+	SignedIn    bool      `json:"signed_in"`
+	Encrypted   bool      `json:"encrypted,omitempty"` // and can't be read without the passphrase
+	Scopes      []string  `json:"scopes,omitempty"`    // granted, if the server said so
+	Expiry      time.Time `json:"expiry"`              // of the access token
+	Refreshable bool      `json:"refreshable"`
+}
+
+// TokenScopes returns the scopes granted with the token, if the token
+// endpoint returned them.
+func TokenScopes(token *oauth2.Token) []string {
+	scope, _ := token.Extra("scope").(string)
+	return strings.Fields(scope)
+}
+
+// CachedTokenStatus describes the cached token of the app, without signing
+// in or refreshing it.
+func CachedTokenStatus(appName string, config *oauth2.Config, opts Options) (*TokenStatus, error) {
+	cacheFile, err := tokenCacheFilename(appName, config, opts.Home)
+	if err != nil {
+		return nil, err
+	}
+	status := &TokenStatus{CacheFile: cacheFile}
+	token, err := tokenFromFile(cacheFile, opts.Passphrase)
+	if os.IsNotExist(err) {
+		return status, nil
+	} else if errors.Is(err, ErrTokenEncrypted) {
+		status.SignedIn, status.Encrypted = true, true
+		return status, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading %q: %w", status.CacheFile, err)
+	}
+
+	status.SignedIn = true
+	status.Scopes = TokenScopes(token)
+	status.Expiry = token.Expiry
+	status.Refreshable = token.RefreshToken != ""
+	return status, nil
+}
+
+// Login signs in again even if there is a cached token, replacing it.
+func Login(ctx context.Context, appName string, config *oauth2.Config, opts Options) (*http.Client, error) {
+	token, err := signIn(ctx, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	cacheFile, err := tokenCacheFilename(appName, config, opts.Home)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveToken(cacheFile, token, opts.Passphrase); err != nil {
+		return nil, fmt.Errorf("Error caching token in %q: %w", cacheFile, err)
+	}
+	source := NewPersistingTokenSource(config.TokenSource(ctx, token), cacheFile, token, opts)
+	return oauth2.NewClient(ctx, source), nil
+}
+
+// Logout deletes the cached token of the app, after revoking it if opts has
+// a RevokeURL. It reports whether the token was revoked; signing out when not
+// signed in is not an error.
+func Logout(ctx context.Context, appName string, config *oauth2.Config, opts Options) (bool, error) {
+	cacheFile, err := tokenCacheFilename(appName, config, opts.Home)
+	if err != nil {
+		return false, err
+	}
+	token, err := tokenFromFile(cacheFile, opts.Passphrase)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil && !errors.Is(err, ErrTokenEncrypted) {
+		return false, fmt.Errorf("Error reading %q: %w", cacheFile, err)
+	}
+
+	// an encrypted token can't be revoked, but it can still be deleted
+	revoked := false
+	if token != nil && opts.RevokeURL != "" {
+		if err := revokeToken(ctx, http.DefaultClient, config, opts.RevokeURL, token); err != nil {
+			return false, err
+		}
+		revoked = true
+	}
+	if err := os.Remove(cacheFile); err != nil && !os.IsNotExist(err) {
+		return revoked, err
+	}
+	return revoked, nil
+}
+
+// revokeToken revokes the refresh token, which also invalidates the access
+// tokens issued with it, or the access token if there is none.
+func revokeToken(ctx context.Context, client *http.Client, config *oauth2.Config, revokeURL string, token *oauth2.Token) error {
+	form := url.Values{
+		"token":           {token.RefreshToken},
+		"token_type_hint": {"refresh_token"},
+		"client_id":       {config.ClientID},
+	}
+	if token.RefreshToken == "" {
+		form.Set("token", token.AccessToken)
+		form.Set("token_type_hint", "access_token")
+	}
+	if config.ClientSecret != "" {
+		form.Set("client_secret", config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Revoking token failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestCachedTokenStatus(t *testing.T) {
+	opts := Options{Home: t.TempDir()}
+	config := &oauth2.Config{ClientID: "client", Scopes: []string{"Files.ReadWrite"}}
+	status, err := CachedTokenStatus("test", config, opts)
+	if err != nil || status.SignedIn || filepath.Dir(status.CacheFile) != filepath.Join(opts.Home, "state", "tokens") {
+		t.Fatalf("expected not to be signed in, got %+v (%v)", status, err)
+	}
+
+	expiry := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	token := (&oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: expiry}).
+		WithExtra(map[string]interface{}{"scope": "Files.ReadWrite offline_access"})
+	if err := saveToken(status.CacheFile, token, nil); err != nil {
+		t.Fatal(err)
+	}
+	status, err = CachedTokenStatus("test", config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &TokenStatus{
+		CacheFile:   status.CacheFile,
+		SignedIn:    true,
+		Scopes:      []string{"Files.ReadWrite", "offline_access"},
+		Expiry:      expiry,
+		Refreshable: true,
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %+v, got %+v", expected, status)
+	}
+
+	// the token can't be read without the passphrase, but it's there
+	defer func(n int) { tokenScryptN = n }(tokenScryptN)
+	tokenScryptN = 1024
+	if err := saveToken(status.CacheFile, token, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	status, err = CachedTokenStatus("test", config, opts)
+	if err != nil || !status.SignedIn || !status.Encrypted {
+		t.Errorf("expected an encrypted token, got %+v (%v)", status, err)
+	}
+}
+
+func TestOldTokenCache(t *testing.T) {
+	// caches from before the scope was stored are gob encoded oauth2.Tokens
+	var old bytes.Buffer
+	if err := gob.NewEncoder(&old).Encode(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := decodeToken(old.Bytes(), nil)
+	if err != nil || token.RefreshToken != "refresh" || len(TokenScopes(token)) != 0 {
+		t.Errorf("failed when decoding old token: %+v (%v)", token, err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	opts := Options{Home: t.TempDir()}
+
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		revoked = append(revoked, r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"), r.PostForm.Get("client_id"))
+	}))
+	defer server.Close()
+
+	config := &oauth2.Config{ClientID: "client"}
+	cacheFile, err := tokenCacheFilename("test", config, opts.Home)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not being signed in is fine
+	if ok, err := Logout(context.Background(), "test", config, opts); ok || err != nil {
+		t.Errorf("expected nothing to sign out of, got %v (%v)", ok, err)
+	}
+
+	// without a revocation endpoint, the token is only deleted
+	saveToken(cacheFile, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}, nil)
+	if ok, err := Logout(context.Background(), "test", config, opts); ok || err != nil {
+		t.Errorf("expected the token not to be revoked, got %v (%v)", ok, err)
+	}
+	if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+		t.Errorf("expected the cached token to be deleted, got %v", err)
+	}
+
+	opts.RevokeURL = server.URL
+	saveToken(cacheFile, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}, nil)
+	if ok, err := Logout(context.Background(), "test", config, opts); !ok || err != nil {
+		t.Errorf("expected the token to be revoked, got %v (%v)", ok, err)
+	}
+	if expected := []string{"refresh", "refresh_token", "client"}; !reflect.DeepEqual(revoked, expected) {
+		t.Errorf("expected revocation %q, got %q", expected, revoked)
+	}
+	if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+		t.Errorf("expected the cached token to be deleted, got %v", err)
+	}
+
+	// a failed revocation keeps the token, so signing out can be retried
+	opts.RevokeURL = server.URL + "/missing"
+	server.Config.Handler = http.NotFoundHandler()
+	saveToken(cacheFile, &oauth2.Token{AccessToken: "access"}, nil)
+	if _, err := Logout(context.Background(), "test", config, opts); err == nil {
+		t.Errorf("expected revocation to fail")
+	}
+	if contents, err := ioutil.ReadFile(cacheFile); err != nil || len(contents) == 0 {
+		t.Errorf("expected the cached token to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// maxBatchSize is the maximum number of requests the service accepts in a
+// single $batch request.
+const maxBatchSize = 20
+
+// BatchRequest is a single sub-request of a JSON batch. The URL is relative to
+// the base URL of the API, e.g. /me/drive/root:/Photos.
+type BatchRequest struct {
+	Id        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a single sub-request of a JSON batch
+type BatchResponse struct {
+	Id      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// Err returns the error for an unsuccessful sub-request as an *Error, or nil
+// if the sub-request succeeded.
+func (r *BatchResponse) Err() error {
+	if r.Status >= 200 && r.Status < 300 {
+		return nil
+	}
+
+	return newError(r.Status, r.Headers["Retry-After"], r.Body)
+}
+
+// Decode decodes the body of a successful sub-request into v
+func (r *BatchResponse) Decode(v interface{}) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	return json.Unmarshal(r.Body, v)
+}
+
+// errBatchUnsupported is returned when the endpoint does not support $batch
+var errBatchUnsupported = errors.New("JSON batching is not supported")
+
+// Batch sends the requests using as few $batch calls as possible and returns
+// the responses in the same order as the requests. A request may depend on
+// any request earlier in the list, it is only executed once its dependencies
+// succeeded and fails with 424 Failed Dependency otherwise.
+//
+// If the endpoint does not support batching the requests are sent one at a
+// time instead.
+func (api *OneDriveAPI) Batch(ctx context.Context, requests []*BatchRequest) ([]*BatchResponse, error) {
+	results := make(map[string]*BatchResponse)
+
+	for start := 0; start < len(requests); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		// dependencies on earlier batches have already been resolved, so
+		// they either fail the request up front or are dropped
+		var batch []*BatchRequest
+		inBatch := make(map[string]bool)
+		for _, req := range requests[start:end] {
+			sub := *req
+			sub.DependsOn = nil
+			failed := false
+			for _, dep := range req.DependsOn {
+				if inBatch[dep] {
+					sub.DependsOn = append(sub.DependsOn, dep)
+				} else if result, ok := results[dep]; !ok || result.Err() != nil {
+					failed = true
+				}
+			}
+			if failed {
+				results[req.Id] = failedDependency(req.Id)
+				continue
+			}
+			inBatch[req.Id] = true
+			batch = append(batch, &sub)
+		}
+
+		responses, err := api.sendBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, resp := range responses {
+			results[resp.Id] = resp
+		}
+	}
+
+	responses := make([]*BatchResponse, len(requests))
+	for idx, req := range requests {
+		responses[idx] = results[req.Id]
+		if responses[idx] == nil {
+			return nil, fmt.Errorf("No response in batch for request %s", req.Id)
+		}
+	}
+	return responses, nil
+}
+
+// sendBatch sends a single $batch request, falling back to individual
+// requests if batching is not available.
+func (api *OneDriveAPI) sendBatch(ctx context.Context, batch []*BatchRequest) ([]*BatchResponse, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	if !api.noBatch.Load() {
+		responses, err := api.postBatch(ctx, batch)
+		if err != errBatchUnsupported {
+			return responses, err
+		}
+		log.Printf("JSON batching is not supported by %s, sending requests individually", api.baseURL)
+		api.noBatch.Store(true)
+	}
+
+	var responses []*BatchResponse
+	results := make(map[string]*BatchResponse)
+	for _, req := range batch {
+		resp := api.sendSingle(ctx, req, results)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		results[req.Id] = resp
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+func (api *OneDriveAPI) postBatch(ctx context.Context, batch []*BatchRequest) ([]*BatchResponse, error) {
+	payload := struct {
+		Requests []*BatchRequest `json:"requests"`
+	}{batch}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", api.baseURL+"/$batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var response struct {
+		Responses []*BatchResponse `json:"responses"`
+	}
+	err = api.doJSON(req, &response)
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			return nil, errBatchUnsupported
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return response.Responses, nil
+}
+
+// sendSingle sends one sub-request on its own, given the responses of the
+// requests sent before it.
+func (api *OneDriveAPI) sendSingle(ctx context.Context, sub *BatchRequest, results map[string]*BatchResponse) *BatchResponse {
+	for _, dep := range sub.DependsOn {
+		if result, ok := results[dep]; !ok || result.Err() != nil {
+			return failedDependency(sub.Id)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, sub.Method, api.baseURL+sub.URL, bytes.NewReader(sub.Body))
+	if err != nil {
+		return clientError(sub.Id, err)
+	}
+	for key, value := range sub.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return clientError(sub.Id, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return clientError(sub.Id, err)
+	}
+	headers := make(map[string]string)
+	for key := range resp.Header {
+		headers[key] = resp.Header.Get(key)
+	}
+	return &BatchResponse{sub.Id, resp.StatusCode, headers, body}
+}
+
+func failedDependency(id string) *BatchResponse {
+	body, _ := json.Marshal(map[string]*Error{
+		"error": &Error{Code: "failedDependency", Message: "A request this request depends on failed"},
+	})
+	return &BatchResponse{Id: id, Status: http.StatusFailedDependency, Body: body}
+}
+
+func clientError(id string, err error) *BatchResponse {
+	body, _ := json.Marshal(map[string]*Error{
+		"error": &Error{Code: "clientError", Message: err.Error()},
+	})
+	return &BatchResponse{Id: id, Status: http.StatusBadRequest, Body: body}
+}
+
+// ItemResult is the outcome of a single operation in a batch
+type ItemResult struct {
+	Item *Item
+	Err  error
+}
+
+// MetadataBatch fetches the metadata for many paths at once. The results are
+// in the same order as the paths.
+func (api *OneDriveAPI) MetadataBatch(ctx context.Context, paths []string) ([]ItemResult, error) {
+	var requests []*BatchRequest
+	for idx, path := range paths {
+		requests = append(requests, &BatchRequest{
+			Id:     strconv.Itoa(idx),
+			Method: "GET",
+			URL:    api.itemPath(path, "") + "?$select=id,name,eTag,cTag,folder,file",
+		})
+	}
+	return api.batchItems(ctx, requests)
+}
+
+// MkdirBatch creates many folders at once, each given by its full path from
+// the root of the drive. Parent folders in the list are created before their
+// children, and a child is not created if creating its parent failed. The
+// results are in the same order as the paths.
+func (api *OneDriveAPI) MkdirBatch(ctx context.Context, paths []string) ([]ItemResult, error) {
+	// sorting the cleaned paths puts every parent before its children, and
+	// finds the parent however its path was written
+	cleaned := make([]string, len(paths))
+	order := make([]int, len(paths))
+	for idx := range order {
+		cleaned[idx] = cleanPath(paths[idx])
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return cleaned[order[i]] < cleaned[order[j]]
+	})
+
+	ids := make(map[string]string)
+	requests := make([]*BatchRequest, len(paths))
+	sorted := make([]*BatchRequest, 0, len(paths))
+	for _, idx := range order {
+		folder := cleaned[idx]
+		parent, name := parentFolder(folder), path.Base(folder)
+
+		body, err := json.Marshal(api.newFolder(name))
+		if err != nil {
+			return nil, err
+		}
+		req := &BatchRequest{
+			Id:      strconv.Itoa(idx),
+			Method:  "POST",
+			URL:     api.itemPath(parent, "children"),
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    body,
+		}
+		if dep, ok := ids[parent]; ok {
+			req.DependsOn = []string{dep}
+		}
+		ids[folder] = req.Id
+		requests[idx] = req
+		sorted = append(sorted, req)
+	}
+
+	results, err := api.batchItems(ctx, sorted)
+	if err != nil {
+		return nil, err
+	}
+
+	// restore the original order of the paths
+	byId := make(map[string]ItemResult)
+	for idx, req := range sorted {
+		byId[req.Id] = results[idx]
+	}
+	ordered := make([]ItemResult, len(paths))
+	for idx, req := range requests {
+		ordered[idx] = byId[req.Id]
+	}
+	return ordered, nil
+}
+
+func (api *OneDriveAPI) batchItems(ctx context.Context, requests []*BatchRequest) ([]ItemResult, error) {
+	responses, err := api.Batch(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ItemResult, len(responses))
+	for idx, resp := range responses {
+		var item Item
+		if err := resp.Decode(&item); err != nil {
+			results[idx].Err = err
+		} else {
+			results[idx].Item = &item
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,220 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeFolders is a minimal drive that only knows how to create folders
+type fakeFolders struct {
+	folders  map[string]bool
+	batches  int
+	requests int
+}
+
+// mkdir handles a POST to /drive/root:/<parent>:/children
+func (f *fakeFolders) mkdir(url string, body []byte) (int, interface{}) {
+	f.requests++
+	parent := strings.TrimSuffix(strings.TrimPrefix(url, "/drive/root:/"), ":/children")
+	if url == "/drive/root/children" {
+		parent = ""
+	}
+	var payload struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(body, &payload)
+
+	if parent != "" && !f.folders[parent] {
+		return 404, map[string]*Error{"error": &Error{Code: "itemNotFound"}}
+	}
+	folder := strings.TrimPrefix(parent+"/"+payload.Name, "/")
+	if f.folders[folder] {
+		return 409, map[string]*Error{"error": &Error{Code: "nameAlreadyExists"}}
+	}
+	f.folders[folder] = true
+	return 201, &Item{Id: folder, Name: payload.Name, Folder: &Folder{}}
+}
+
+func (f *fakeFolders) handler(batching bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.URL.Path != "/$batch" {
+			status, response := f.mkdir(req.URL.Path, body)
+			rw.WriteHeader(status)
+			json.NewEncoder(rw).Encode(response)
+			return
+		}
+		if !batching {
+			http.Error(rw, `{"error": {"code": "itemNotFound"}}`, 404)
+			return
+		}
+
+		f.batches++
+		var batch struct {
+			Requests []*BatchRequest `json:"requests"`
+		}
+		json.Unmarshal(body, &batch)
+		if len(batch.Requests) > maxBatchSize {
+			http.Error(rw, `{"error": {"code": "invalidRequest"}}`, 400)
+			return
+		}
+
+		var responses []*BatchResponse
+		status := make(map[string]int)
+		for _, sub := range batch.Requests {
+			failed := false
+			for _, dep := range sub.DependsOn {
+				if status[dep] >= 300 {
+					failed = true
+				}
+			}
+			if failed {
+				status[sub.Id] = 424
+				responses = append(responses, &BatchResponse{Id: sub.Id, Status: 424})
+				continue
+			}
+			code, response := f.mkdir(sub.URL, sub.Body)
+			encoded, _ := json.Marshal(response)
+			status[sub.Id] = code
+			responses = append(responses, &BatchResponse{Id: sub.Id, Status: code, Body: encoded})
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"responses": responses})
+	})
+}
+
+func TestMkdirBatch(t *testing.T) {
+	for _, batching := range []bool{true, false} {
+		fake := &fakeFolders{folders: map[string]bool{"existing": true}}
+		server := httptest.NewServer(fake.handler(batching))
+
+		// children are listed before their parents on purpose, and there
+		// are enough folders to need more than one batch
+		paths := []string{"a/b/c", "a/b", "a", "existing", "missing/child"}
+		for i := 0; i < maxBatchSize; i++ {
+			paths = append(paths, "a/b/c/"+string(rune('a'+i)))
+		}
+
+		api := NewOneDriveAPI(server.Client(), server.URL, "")
+		results, err := api.MkdirBatch(context.Background(), paths)
+		server.Close()
+		if err != nil {
+			t.Fatalf("batching=%v: unexpected error %s", batching, err)
+		}
+
+		for idx, result := range results {
+			switch paths[idx] {
+			case "existing":
+				if !errors.Is(result.Err, Conflict) {
+					t.Errorf("batching=%v: expected conflict for %s, got %v", batching, paths[idx], result.Err)
+				}
+			case "missing/child":
+				if !errors.Is(result.Err, PathNotFound) {
+					t.Errorf("batching=%v: expected not found for %s, got %v", batching, paths[idx], result.Err)
+				}
+			default:
+				if result.Err != nil || result.Item.Id != paths[idx] {
+					t.Errorf("batching=%v: expected %s to be created, got %v", batching, paths[idx], result.Err)
+				}
+			}
+		}
+
+		if batching && fake.batches != 2 {
+			t.Errorf("expected 2 batches, got %d", fake.batches)
+		}
+		if !batching && fake.requests != len(paths) {
+			t.Errorf("expected %d individual requests, got %d", len(paths), fake.requests)
+		}
+	}
+}
+
+func TestBatchFailedDependency(t *testing.T) {
+	fake := &fakeFolders{folders: map[string]bool{}}
+	server := httptest.NewServer(fake.handler(false))
+	defer server.Close()
+
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+	results, err := api.MkdirBatch(context.Background(), []string{"x/y", "x/y/z"})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	var apiErr *Error
+	if !errors.As(results[1].Err, &apiErr) || apiErr.StatusCode != http.StatusFailedDependency {
+		t.Errorf("expected a failed dependency, got %v", results[1].Err)
+	}
+	if fake.requests != 1 {
+		t.Errorf("expected only the parent to be requested, got %d requests", fake.requests)
+	}
+}
+
+func TestMkdirBatchUncleanPaths(t *testing.T) {
+	fake := &fakeFolders{folders: map[string]bool{}}
+	server := httptest.NewServer(fake.handler(true))
+	defer server.Close()
+
+	// the parents are only found when the paths are cleaned before they
+	// are sorted
+	paths := []string{"x//y/z/", "./x/y", "x"}
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+	results, err := api.MkdirBatch(context.Background(), paths)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	for idx, expected := range []string{"x/y/z", "x/y", "x"} {
+		if results[idx].Err != nil || results[idx].Item.Id != expected {
+			t.Errorf("expected %s to be created as %s, got %v", paths[idx], expected, results[idx].Err)
+		}
+	}
+}
+
+func TestMetadataBatch(t *testing.T) {
+	for _, batchError := range []int{0, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented} {
+		drive := newFakeDrive()
+		drive.batchError = batchError
+		server := httptest.NewServer(drive)
+
+		api := NewOneDriveAPI(server.Client(), server.URL, "")
+		if _, err := api.Mkdir("", "Photos"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := api.Mkdir("Photos", "100% #1: Sommer?"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		paths := []string{"Photos/100% #1: Sommer?", "missing", "Photos", ""}
+		requests := len(drive.requests)
+		results, err := api.MetadataBatch(context.Background(), paths)
+		if err != nil {
+			t.Fatalf("batchError=%d: unexpected error %s", batchError, err)
+		}
+		for idx, result := range results {
+			if paths[idx] == "missing" {
+				if !errors.Is(result.Err, PathNotFound) {
+					t.Errorf("batchError=%d: expected not found for %s, got %v", batchError, paths[idx], result.Err)
+				}
+			} else if result.Err != nil || result.Item.Id != drive.items[paths[idx]].Id || result.Item.Folder == nil {
+				t.Errorf("batchError=%d: expected the metadata of %q, got %#v (%v)", batchError, paths[idx], result.Item, result.Err)
+			}
+		}
+
+		// sub-requests are recorded by the fake drive like individual ones
+		sent := drive.requests[requests:]
+		if len(sent) != 1+len(paths) || sent[0] != "/$batch" {
+			t.Errorf("batchError=%d: expected a batch of %d requests, got %v", batchError, len(paths), sent)
+		}
+
+		// once batching failed, it isn't tried again
+		requests = len(drive.requests)
+		api.MetadataBatch(context.Background(), paths)
+		if batchError != 0 && drive.requests[requests] == "/$batch" {
+			t.Errorf("batchError=%d: expected no more batches, got %v", batchError, drive.requests[requests:])
+		}
+		server.Close()
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package onedrive
 
 import "encoding/json"
 
@@ -0,0 +1,148 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// MicrosoftDeviceAuthURL is the device authorization endpoint of the
+// Microsoft identity platform for work, school and personal accounts.
+const MicrosoftDeviceAuthURL = "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode"
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceCode is the response of the device authorization endpoint
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Message         string `json:"message"`
+}
+
+// tokenResponse is the response of the token endpoint to the grants that
+// aren't handled by the oauth2 package
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// deviceSleep waits between polls of the token endpoint, tests replace it
+var deviceSleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DeviceToken signs in with the device authorization grant, which needs
+// neither a browser nor a local listener on this machine. The prompt is
+// called with the code the user has to enter at the verification URL on any
+// other device, after which the token endpoint is polled until the user has
+// signed in, declined or the code has expired.
+func DeviceToken(ctx context.Context, client *http.Client, config *oauth2.Config, deviceAuthURL string, prompt func(*DeviceCode)) (*oauth2.Token, error) {
+	form := url.Values{
+		"client_id": {config.ClientID},
+		"scope":     {strings.Join(config.Scopes, " ")},
+	}
+	var code DeviceCode
+	if err := postForm(ctx, client, deviceAuthURL, form, &code); err != nil {
+		return nil, fmt.Errorf("Device authorization failed: %w", err)
+	}
+	if code.DeviceCode == "" || code.UserCode == "" {
+		return nil, fmt.Errorf("Device authorization failed: no device code in response")
+	}
+	prompt(&code)
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expires := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	form = url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"client_id":   {config.ClientID},
+		"device_code": {code.DeviceCode},
+	}
+	if config.ClientSecret != "" {
+		form.Set("client_secret", config.ClientSecret)
+	}
+	for {
+		if err := deviceSleep(ctx, interval); err != nil {
+			return nil, err
+		}
+		if code.ExpiresIn > 0 && time.Now().After(expires) {
+			return nil, fmt.Errorf("Device code expired before sign in completed")
+		}
+
+		var response tokenResponse
+		if err := postForm(ctx, client, config.Endpoint.TokenURL, form, &response); err != nil {
+			return nil, err
+		}
+		switch response.Error {
+		case "":
+			token := &oauth2.Token{
+				AccessToken:  response.AccessToken,
+				RefreshToken: response.RefreshToken,
+				TokenType:    response.TokenType,
+			}
+			if response.ExpiresIn > 0 {
+				token.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+			}
+			if response.Scope != "" {
+				token = token.WithExtra(map[string]interface{}{"scope": response.Scope})
+			}
+			return token, nil
+		case "authorization_pending":
+			// the user hasn't finished signing in yet
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, fmt.Errorf("Device sign in failed: %s %s", response.Error, response.ErrorDescription)
+		}
+	}
+}
+
+// postForm posts the form and decodes the JSON response into v. Token
+// endpoints report errors such as authorization_pending with a 400 status
+// and a JSON body, so those are decoded too.
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 500 || (resp.StatusCode >= 300 && !json.Valid(body)) {
+		return fmt.Errorf("Unexpected response %s", resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
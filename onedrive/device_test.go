@@ -0,0 +1,116 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeDeviceServer implements the device authorization and token endpoints.
+// The token endpoint answers with the given errors before issuing a token.
+type fakeDeviceServer struct {
+	errors []string
+	polls  int
+}
+
+func (s *fakeDeviceServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	switch req.URL.Path {
+	case "/devicecode":
+		if req.FormValue("client_id") != "client" || req.FormValue("scope") != "offline_access Files.ReadWrite" {
+			rw.WriteHeader(400)
+			json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_request"})
+			return
+		}
+		json.NewEncoder(rw).Encode(&DeviceCode{
+			DeviceCode:      "device123",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: "https://microsoft.com/devicelogin",
+			ExpiresIn:       900,
+			Interval:        2,
+		})
+	case "/token":
+		if req.FormValue("grant_type") != deviceCodeGrantType || req.FormValue("device_code") != "device123" {
+			rw.WriteHeader(400)
+			json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		s.polls++
+		if s.polls <= len(s.errors) {
+			rw.WriteHeader(400)
+			json.NewEncoder(rw).Encode(map[string]string{"error": s.errors[s.polls-1]})
+			return
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+func TestDeviceToken(t *testing.T) {
+	var waits []time.Duration
+	defer func(sleep func(context.Context, time.Duration) error) { deviceSleep = sleep }(deviceSleep)
+	deviceSleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	fake := &fakeDeviceServer{errors: []string{"authorization_pending", "slow_down", "authorization_pending"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	config := &oauth2.Config{
+		ClientID: "client",
+		Scopes:   []string{"offline_access", "Files.ReadWrite"},
+		Endpoint: oauth2.Endpoint{TokenURL: server.URL + "/token"},
+	}
+
+	var prompted *DeviceCode
+	token, err := DeviceToken(context.Background(), server.Client(), config, server.URL+"/devicecode", func(code *DeviceCode) {
+		prompted = code
+	})
+	if err != nil {
+		t.Fatalf("failed when signing in: %s", err)
+	}
+	if prompted == nil || prompted.UserCode != "ABCD-EFGH" {
+		t.Errorf("expected the user to be prompted with the code, got %#v", prompted)
+	}
+	if token.AccessToken != "access" || token.RefreshToken != "refresh" || token.Expiry.IsZero() {
+		t.Errorf("unexpected token %#v", token)
+	}
+
+	// the interval is increased by five seconds after slow_down
+	expected := []time.Duration{2 * time.Second, 2 * time.Second, 7 * time.Second, 7 * time.Second}
+	if len(waits) != len(expected) {
+		t.Fatalf("expected %d polls, got waits %v", len(expected), waits)
+	}
+	for idx := range expected {
+		if waits[idx] != expected[idx] {
+			t.Errorf("poll %d: expected to wait %s, got %s", idx, expected[idx], waits[idx])
+		}
+	}
+
+	for _, failure := range []string{"access_denied", "expired_token"} {
+		fake.errors, fake.polls = []string{"authorization_pending", failure}, 0
+		if _, err := DeviceToken(context.Background(), server.Client(), config, server.URL+"/devicecode", func(*DeviceCode) {}); err == nil {
+			t.Errorf("expected an error for %s", failure)
+		}
+	}
+
+	// cancelling stops polling
+	deviceSleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DeviceToken(ctx, server.Client(), config, server.URL+"/devicecode", func(*DeviceCode) {}); err == nil {
+		t.Errorf("expected an error for a cancelled context")
+	}
+}
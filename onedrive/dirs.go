@@ -0,0 +1,165 @@
+package onedrive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// HomeEnv is the environment variable that overrides where configuration,
+// caches and state are kept, e.g. to run several independent setups
+const HomeEnv = "CLOUD_BACKUP_HOME"
+
+// dirsName is the name of the folder inside the user's directories
+const dirsName = "cloud-backup"
+
+// Dirs are the directories the configuration, caches and state are kept
+// in. Caches can be deleted at any time, unlike state such as tokens.
+type Dirs struct {
+	Config string // configuration written by the user, e.g. profiles
+	Cache  string // e.g. thumbnails and hashes of local files
+	State  string // e.g. tokens, upload sessions and logs
+}
+
+// UserDirs returns the directories of the current user. Everything is kept
+// in home if it is given, and otherwise in the XDG base directories where
+// they are set, falling back to the conventions of the operating system.
+func UserDirs(home string) (*Dirs, error) {
+	if home != "" {
+		home, err := filepath.Abs(home)
+		if err != nil {
+			return nil, err
+		}
+		return &Dirs{
+			Config: filepath.Join(home, "config"),
+			Cache:  filepath.Join(home, "cache"),
+			State:  filepath.Join(home, "state"),
+		}, nil
+	}
+
+	config, err := xdgDir("XDG_CONFIG_HOME", os.UserConfigDir, ".config")
+	if err != nil {
+		return nil, err
+	}
+	cache, err := xdgDir("XDG_CACHE_HOME", os.UserCacheDir, ".cache")
+	if err != nil {
+		return nil, err
+	}
+	// systems without XDG have no separate place for state, so it is kept with
+	// the configuration
+	state, err := xdgDir("XDG_STATE_HOME", os.UserConfigDir, filepath.Join(".local", "state"))
+	if err != nil {
+		return nil, err
+	}
+	return &Dirs{
+		Config: filepath.Join(config, dirsName),
+		Cache:  filepath.Join(cache, dirsName),
+		State:  filepath.Join(state, dirsName),
+	}, nil
+}
+
+// xdgDir returns the directory in the environment variable if it's set.
+// Otherwise it's the directory relative to the home directory on systems
+// that follow the XDG specification, and the fallback on others. Relative
+// paths are invalid according to the specification and ignored.
+func xdgDir(env string, fallback func() (string, error), relative string) (string, error) {
+	if dir := os.Getenv(env); dir != "" && filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return fallback()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, relative), nil
+}
+
+// Tokens is the directory OAuth tokens are cached in
+func (d *Dirs) Tokens() string {
+	return filepath.Join(d.State, "tokens")
+}
+
+// Thumbnails is the directory thumbnails are cached in
+func (d *Dirs) Thumbnails() string {
+	return filepath.Join(d.Cache, "thumbnails")
+}
+
+// Hashes is the directory the hashes of local files are cached in, so that
+// unchanged files aren't read again on every run
+func (d *Dirs) Hashes() string {
+	return filepath.Join(d.Cache, "hashes")
+}
+
+// Uploads is the directory upload sessions in progress are kept in, so that
+// interrupted uploads can be resumed
+func (d *Dirs) Uploads() string {
+	return filepath.Join(d.State, "uploads")
+}
+
+// Logs is the directory logs are written to
+func (d *Dirs) Logs() string {
+	return filepath.Join(d.State, "logs")
+}
+
+// tokenDir returns the directory tokens are cached in, creating it if needed
+func tokenDir(home string) (string, error) {
+	dirs, err := UserDirs(home)
+	if err != nil {
+		return "", err
+	}
+	return dirs.Tokens(), os.MkdirAll(dirs.Tokens(), 0700)
+}
+
+// legacyTokenDir returns the directory tokens were cached in before Dirs,
+// if there was one on this operating system.
+func legacyTokenDir() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(os.Getenv("HOME"), "Library", "Caches")
+	case "linux", "freebsd":
+		return filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return ""
+}
+
+// migrateToken moves a token cached in the legacy directory to file, unless
+// there already is a token there.
+func migrateToken(legacyDir, file string) error {
+	if legacyDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		return err
+	}
+	legacy := filepath.Join(legacyDir, filepath.Base(file))
+	if _, err := os.Stat(legacy); os.IsNotExist(err) {
+		return nil
+	}
+
+	// the directories may be on different filesystems, and the legacy token
+	// may have been readable by others
+	if err := os.Rename(legacy, file); err == nil {
+		log.Printf("Moved cached oauth token from %q to %q", legacy, file)
+		return os.Chmod(file, 0600)
+	}
+	if err := copyFile(legacy, file); err != nil {
+		return fmt.Errorf("Failed to move cached oauth token from %q: %w", legacy, err)
+	}
+	log.Printf("Moved cached oauth token from %q to %q", legacy, file)
+	return os.Remove(legacy)
+}
+
+// copyFile copies src to dst, which is only readable by its owner
+func copyFile(src, dst string) error {
+	contents, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, contents)
+}
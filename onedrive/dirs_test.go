@@ -0,0 +1,86 @@
+package onedrive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestUserDirs(t *testing.T) {
+	home := t.TempDir()
+	dirs, err := UserDirs(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Dirs{
+		Config: filepath.Join(home, "config"),
+		Cache:  filepath.Join(home, "cache"),
+		State:  filepath.Join(home, "state"),
+	}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, dirs)
+	}
+	if dirs.Tokens() != filepath.Join(home, "state", "tokens") {
+		t.Errorf("unexpected token directory %q", dirs.Tokens())
+	}
+
+	if runtime.GOOS != "linux" {
+		t.Skip("the fallbacks depend on the operating system")
+	}
+	t.Setenv("HOME", "/home/user")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_CACHE_HOME", "relative/cache") // invalid, so ignored
+	t.Setenv("XDG_STATE_HOME", "")
+	dirs, err = UserDirs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = &Dirs{
+		Config: "/xdg/config/cloud-backup",
+		Cache:  "/home/user/.cache/cloud-backup",
+		State:  "/home/user/.local/state/cloud-backup",
+	}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, dirs)
+	}
+}
+
+func TestMigrateToken(t *testing.T) {
+	legacy, dir := t.TempDir(), t.TempDir()
+	file := filepath.Join(dir, "onedrive-sync-token123")
+
+	// nothing to migrate
+	if err := migrateToken(legacy, file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected no token, got %v", err)
+	}
+
+	// legacy tokens were readable by others
+	ioutil.WriteFile(filepath.Join(legacy, "onedrive-sync-token123"), []byte("old"), 0644)
+	if err := migrateToken(legacy, file); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadFile(file); err != nil || string(contents) != "old" {
+		t.Errorf("expected the token to be moved, got %q (%v)", contents, err)
+	}
+	if stat, _ := os.Stat(file); stat.Mode().Perm() != 0600 {
+		t.Errorf("expected permissions 0600, got %o", stat.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "onedrive-sync-token123")); !os.IsNotExist(err) {
+		t.Errorf("expected the legacy token to be gone, got %v", err)
+	}
+
+	// a newer token isn't overwritten
+	ioutil.WriteFile(filepath.Join(legacy, "onedrive-sync-token123"), []byte("older"), 0600)
+	if err := migrateToken(legacy, file); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := ioutil.ReadFile(file); string(contents) != "old" {
+		t.Errorf("expected the token to be kept, got %q", contents)
+	}
+}
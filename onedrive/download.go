@@ -0,0 +1,76 @@
+package onedrive
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+func (api *OneDriveAPI) Download(remotePath string, w io.Writer) error {
+	return api.DownloadContext(context.Background(), remotePath, w)
+}
+
+// DownloadContext writes the contents of the remote file to w
+func (api *OneDriveAPI) DownloadContext(ctx context.Context, remotePath string, w io.Writer) error {
+	resp, err := api.getContent(ctx, api.endpoint(api.itemPath(remotePath, "content"), ""))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// getContent fetches contents, such as those of a file or a thumbnail, and
+// returns the successful response. The API redirects to a pre-authenticated
+// URL for contents, which like upload URLs must not be sent the client's
+// credentials, so the redirect is followed without them.
+func (api *OneDriveAPI) getContent(ctx context.Context, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *api.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+		resp.Body.Close()
+		req, err = http.NewRequestWithContext(ctx, "GET", location, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = api.uploadClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (api *OneDriveAPI) Children(folderPath string) ([]*Item, error) {
+	return api.ChildrenContext(context.Background(), folderPath)
+}
+
+// ChildrenContext returns the files and folders in the folder
+func (api *OneDriveAPI) ChildrenContext(ctx context.Context, folderPath string) ([]*Item, error) {
+	endpoint := api.endpoint(api.itemPath(folderPath, "children"), "$select=id,name,eTag,size,folder,file,fileSystemInfo")
+
+	var result []*Item
+	err := api.listItems(ctx, endpoint, func(item *Item) {
+		result = append(result, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
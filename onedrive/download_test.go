@@ -0,0 +1,73 @@
+package onedrive
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewTokenProviderAPI(StaticTokenProvider("token"), server.Client(), server.URL, "")
+	if _, err := api.EnsureFolder("Backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	// small files are uploaded directly and large ones in sessions
+	for _, size := range []int64{12, simpleUploadLimit + 1} {
+		contents := bytes.Repeat([]byte("x"), int(size))
+		local := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(local, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.Upload(local, "Backup/file"); err != nil {
+			t.Fatal(err)
+		}
+
+		var downloaded bytes.Buffer
+		if err := api.Download("Backup/file", &downloaded); err != nil {
+			t.Fatalf("failed when downloading %d bytes: %s", size, err)
+		}
+		if !bytes.Equal(downloaded.Bytes(), contents) {
+			t.Errorf("expected %d bytes, got %d", size, downloaded.Len())
+		}
+	}
+
+	if err := api.Download("Backup/missing", &bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestChildren(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	local := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(local, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.EnsureFolder("Backup/Albums"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Upload(local, "Backup/photo.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	children, err := api.Children("Backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, child := range children {
+		names[child.Name] = child.Folder != nil
+	}
+	if len(names) != 2 || names["photo.jpg"] || !names["Albums"] {
+		t.Errorf("expected a file and a folder, got %v", names)
+	}
+}
@@ -0,0 +1,159 @@
+package onedrive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	OneDriveBaseURL = "https://api.onedrive.com/v1.0"
+	GraphBaseURL    = "https://graph.microsoft.com/v1.0"
+
+	// DefaultDrive is the drive of the signed in user on the OneDrive API
+	DefaultDrive = "/drive"
+
+	// DriveRoot is the root folder of a drive
+	DriveRoot = "/root"
+	// AppFolderRoot is the folder dedicated to the application, which is
+	// the only folder it can access with the app folder scopes
+	AppFolderRoot = "/special/approot"
+)
+
+// NewOneDriveAPI returns a client for the given drive. The drive is a path
+// relative to baseURL as returned by ParseDrive, and defaults to DefaultDrive.
+func NewOneDriveAPI(client *http.Client, baseURL, drive string) *OneDriveAPI {
+	if drive == "" {
+		drive = DefaultDrive
+	}
+	return &OneDriveAPI{
+		client:       client,
+		uploadClient: http.DefaultClient,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		drive:        drive,
+		root:         DriveRoot,
+	}
+}
+
+// NewAppFolderAPI returns a client like NewOneDriveAPI, but all paths are
+// relative to the app folder rather than the root of the drive. It only needs
+// the narrower AppFolderScopes.
+func NewAppFolderAPI(client *http.Client, baseURL, drive string) *OneDriveAPI {
+	api := NewOneDriveAPI(client, baseURL, drive)
+	api.root = AppFolderRoot
+	return api
+}
+
+// ParseEndpoint returns the base URL for an endpoint name, which is either
+// "onedrive" (the consumer OneDrive API), "graph" (Microsoft Graph, required
+// for OneDrive for Business and SharePoint) or an explicit URL.
+func ParseEndpoint(endpoint string) (string, error) {
+	switch endpoint {
+	case "", "onedrive":
+		return OneDriveBaseURL, nil
+	case "graph":
+		return GraphBaseURL, nil
+	}
+	if strings.HasPrefix(endpoint, "https://") || strings.HasPrefix(endpoint, "http://") {
+		return strings.TrimSuffix(endpoint, "/"), nil
+	}
+	return "", fmt.Errorf("Unknown endpoint %q, expected onedrive, graph or a URL", endpoint)
+}
+
+// ParseDrive returns the path addressing the drive given by spec, which can
+// be one of:
+//
+//	default        the default drive (/drive)
+//	me             the signed in user's drive on Microsoft Graph (/me/drive)
+//	id:<drive id>  a drive by its id (/drives/{id})
+//	user:<user>    a user's drive by principal name or id (/users/{user}/drive)
+//	site:<site id> the default document library of a SharePoint site
+//
+// The ids are escaped, so they can't address anything but a drive.
+func ParseDrive(spec string) (string, error) {
+	kind, value := spec, ""
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		kind, value = spec[:idx], escapeId(spec[idx+1:])
+	}
+
+	switch {
+	case spec == "" || spec == "default":
+		return DefaultDrive, nil
+	case spec == "me":
+		return "/me/drive", nil
+	case kind == "id" && value != "":
+		return "/drives/" + value, nil
+	case kind == "site" && value != "":
+		return "/sites/" + value + "/drive", nil
+	case kind == "user" && value != "":
+		return "/users/" + value + "/drive", nil
+	}
+	return "", fmt.Errorf("Invalid drive %q, expected default, me, id:<drive id>, user:<user> or site:<site id>", spec)
+}
+
+// idUnescaper restores the characters that are valid in a path segment and
+// common in ids: business drive ids start with b! and commas separate the
+// parts of a site id
+var idUnescaper = strings.NewReplacer("%21", "!", "%2C", ",")
+
+// escapeId escapes an id for a path segment
+func escapeId(id string) string {
+	return idUnescaper.Replace(url.PathEscape(id))
+}
+
+// DefaultScopes returns the OAuth scopes needed to read and write files on
+// the given endpoint.
+func DefaultScopes(baseURL string) []string {
+	if baseURL == OneDriveBaseURL {
+		return []string{"wl.signin", "wl.offline_access", "onedrive.readwrite"}
+	}
+	return []string{"offline_access", "Files.ReadWrite.All"}
+}
+
+// AppFolderScopes returns the OAuth scopes needed to read and write files in
+// the app folder only.
+func AppFolderScopes(baseURL string) []string {
+	if baseURL == OneDriveBaseURL {
+		return []string{"wl.signin", "wl.offline_access", "onedrive.appfolder"}
+	}
+	return []string{"offline_access", "Files.ReadWrite.AppFolder"}
+}
+
+func (api *OneDriveAPI) AppFolder() (*Item, error) {
+	return api.AppFolderContext(context.Background())
+}
+
+// AppFolderContext returns the app folder of the drive, which is created on
+// first access, usually as Apps/<application name>.
+func (api *OneDriveAPI) AppFolderContext(ctx context.Context) (*Item, error) {
+	var response Item
+	err := api.getJSON(ctx, api.baseURL+api.drive+AppFolderRoot, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.SpecialFolder == nil || response.SpecialFolder.Name != "approot" {
+		return nil, fmt.Errorf("Item %s is not the app folder", response.Id)
+	}
+	return &response, nil
+}
+
+// conflictBehavior returns the name of the annotation that sets the behaviour
+// when an item with the same name already exists (fail, replace or rename).
+// The annotation was renamed on Microsoft Graph.
+func (api *OneDriveAPI) conflictBehavior() string {
+	if api.baseURL == OneDriveBaseURL {
+		return "@name.conflictBehavior"
+	}
+	return "@microsoft.graph.conflictBehavior"
+}
+
+// action returns the path segment for calling the named action on an item.
+// Actions are namespaced on the OneDrive API, e.g. action.createLink.
+func (api *OneDriveAPI) action(name string) string {
+	if api.baseURL == OneDriveBaseURL {
+		return "action." + name
+	}
+	return name
+}
@@ -0,0 +1,124 @@
+package onedrive
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDrive(t *testing.T) {
+	type testCase struct {
+		spec     string
+		expected string
+		err      bool
+	}
+
+	testCases := []testCase{
+		testCase{"", "/drive", false},
+		testCase{"default", "/drive", false},
+		testCase{"me", "/me/drive", false},
+		testCase{"id:b!abc123", "/drives/b!abc123", false},
+		testCase{"site:contoso.sharepoint.com,1234,5678", "/sites/contoso.sharepoint.com,1234,5678/drive", false},
+		testCase{"user:backup@contoso.com", "/users/backup@contoso.com/drive", false},
+		testCase{"id:a/b?c#d%", "/drives/a%2Fb%3Fc%23d%25", false},
+		testCase{"user:../me", "/users/..%2Fme/drive", false},
+		testCase{"user:first last@contoso.com", "/users/first%20last@contoso.com/drive", false},
+		testCase{"site:contoso.sharepoint.com,1/2,3?x", "/sites/contoso.sharepoint.com,1%2F2,3%3Fx/drive", false},
+		testCase{"user:", "", true},
+		testCase{"id:", "", true},
+		testCase{"bogus", "", true},
+	}
+
+	for _, test := range testCases {
+		drive, err := ParseDrive(test.spec)
+		if test.err && err == nil {
+			t.Errorf("%q: expected an error, got %q", test.spec, drive)
+		} else if !test.err && (err != nil || drive != test.expected) {
+			t.Errorf("%q: expected %q, got %q (%v)", test.spec, test.expected, drive, err)
+		}
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	type testCase struct {
+		endpoint string
+		expected string
+	}
+
+	testCases := []testCase{
+		testCase{"onedrive", OneDriveBaseURL},
+		testCase{"graph", GraphBaseURL},
+		testCase{"https://graph.microsoft.com/beta/", "https://graph.microsoft.com/beta"},
+	}
+
+	for _, test := range testCases {
+		baseURL, err := ParseEndpoint(test.endpoint)
+		if err != nil || baseURL != test.expected {
+			t.Errorf("%q: expected %q, got %q (%v)", test.endpoint, test.expected, baseURL, err)
+		}
+	}
+
+	if _, err := ParseEndpoint("ftp://example.com"); err == nil {
+		t.Errorf("expected an error for an unknown endpoint")
+	}
+}
+
+func TestAppFolder(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewAppFolderAPI(server.Client(), server.URL, "")
+
+	appFolder, err := api.AppFolder()
+	if err != nil {
+		t.Fatalf("failed when fetching the app folder: %s", err)
+	}
+	if appFolder.SpecialFolder == nil || appFolder.SpecialFolder.Name != "approot" {
+		t.Errorf("expected the approot special folder, got %#v", appFolder)
+	}
+
+	if _, err := api.EnsureFolder("Backups/2015"); err != nil {
+		t.Fatalf("failed when creating folders: %s", err)
+	}
+	local := filepath.Join(t.TempDir(), "beach.jpg")
+	os.WriteFile(local, []byte("contents"), 0644)
+	if _, err := api.Upload(local, "Backups/2015/beach.jpg"); err != nil {
+		t.Fatalf("failed when uploading: %s", err)
+	}
+
+	// everything ends up inside the app folder
+	if drive.items["Backups"] != nil {
+		t.Errorf("expected no folders outside of the app folder")
+	}
+	if drive.items[fakeAppFolder+"/Backups/2015/beach.jpg"] == nil {
+		t.Errorf("expected the file inside the app folder")
+	}
+	for _, request := range drive.requests {
+		if strings.HasPrefix(request, "/drive/root") {
+			t.Errorf("expected no requests outside of the app folder, got %s", request)
+		}
+	}
+
+	hashes, err := api.ChildHashes("Backups/2015")
+	if err != nil || len(hashes) != 1 || hashes[0].Name != "beach.jpg" {
+		t.Errorf("expected to list the uploaded file, got %v (%v)", hashes, err)
+	}
+
+	// search results are relative to the app folder too
+	results, err := api.Search("Backups", "beach")
+	if err != nil || len(results) != 1 || results[0].Path != "Backups/2015/beach.jpg" {
+		t.Errorf("expected a search result relative to the app folder, got %v (%v)", results, err)
+	}
+}
+
+func TestAppFolderScopes(t *testing.T) {
+	for _, baseURL := range []string{OneDriveBaseURL, GraphBaseURL} {
+		for _, scope := range AppFolderScopes(baseURL) {
+			if strings.Contains(scope, "readwrite") || strings.HasSuffix(scope, ".All") {
+				t.Errorf("%s: expected no drive-wide scopes, got %s", baseURL, scope)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package onedrive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	PathNotFound  = fmt.Errorf("PathNotFound")
+	Conflict      = fmt.Errorf("Conflict")
+	QuotaExceeded = fmt.Errorf("QuotaExceeded")
+	Throttled     = fmt.Errorf("Throttled")
+	Unauthorized  = fmt.Errorf("Unauthorized")
+	NameInvalid   = fmt.Errorf("NameInvalid")
+
+	PreconditionFailed = fmt.Errorf("PreconditionFailed")
+)
+
+// InnerError is the (possibly nested) detailed error returned by OneDrive
+type InnerError struct {
+	Code       string      `json:"code"`
+	InnerError *InnerError `json:"innererror"`
+}
+
+// Error is the error response returned by the OneDrive API for any request
+// that did not succeed. It can be compared against the sentinel errors above
+// using errors.Is.
+type Error struct {
+	StatusCode int           `json:"-"` // the HTTP status code of the response
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	InnerError *InnerError   `json:"innererror"`
+	RetryAfter time.Duration `json:"-"` // the value of the Retry-After header, if any
+}
+
+func (e *Error) Error() string {
+	codes := e.Code
+	for inner := e.InnerError; inner != nil; inner = inner.InnerError {
+		codes += "/" + inner.Code
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("onedrive: %d %s", e.StatusCode, codes)
+	}
+	return fmt.Sprintf("onedrive: %d %s: %s", e.StatusCode, codes, e.Message)
+}
+
+// HasCode returns true if the error or any of its inner errors has the given
+// error code.
+func (e *Error) HasCode(code string) bool {
+	if e.Code == code {
+		return true
+	}
+	for inner := e.InnerError; inner != nil; inner = inner.InnerError {
+		if inner.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case PathNotFound:
+		return e.StatusCode == http.StatusNotFound || e.HasCode("itemNotFound")
+	case Conflict:
+		return e.StatusCode == http.StatusConflict || e.HasCode("nameAlreadyExists")
+	case QuotaExceeded:
+		return e.StatusCode == http.StatusInsufficientStorage || e.HasCode("quotaLimitReached")
+	case Throttled:
+		return e.StatusCode == http.StatusTooManyRequests ||
+			e.HasCode("activityLimitReached") || e.HasCode("throttledRequest")
+	case Unauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.HasCode("unauthenticated")
+	case PreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed ||
+			e.HasCode("resourceModified") || e.HasCode("entityTagDoesNotMatch")
+	case NameInvalid:
+		return e.HasCode("invalidPath") || e.HasCode("pathIsTooLong") ||
+			e.HasCode("nameContainsInvalidCharacters")
+	}
+	return false
+}
+
+// checkResponse returns nil if the response has a successful status code,
+// otherwise it consumes the body and decodes it into an *Error.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return newError(resp.StatusCode, resp.Header.Get("Retry-After"), body)
+}
+
+// newError decodes an error response with the given status code, Retry-After
+// header and body.
+func newError(statusCode int, retryAfter string, body []byte) *Error {
+	apiErr := &Error{StatusCode: statusCode}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var response struct {
+		Error *Error `json:"error"`
+	}
+	response.Error = apiErr
+	if err := json.Unmarshal(body, &response); err != nil || apiErr.Code == "" {
+		// not a JSON error response, so keep whatever we were sent
+		apiErr.Message = string(body)
+	}
+	return apiErr
+}
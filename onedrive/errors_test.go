@@ -0,0 +1,80 @@
+package onedrive
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorResponses(t *testing.T) {
+	type testCase struct {
+		status   int
+		body     string
+		expected error
+	}
+
+	testCases := []testCase{
+		testCase{404, `{"error": {"code": "itemNotFound", "message": "Item does not exist"}}`, PathNotFound},
+		testCase{409, `{"error": {"code": "nameAlreadyExists", "message": "Name already exists"}}`, Conflict},
+		testCase{507, `{"error": {"code": "quotaLimitReached", "message": "Insufficient Storage"}}`, QuotaExceeded},
+		testCase{429, `{"error": {"code": "activityLimitReached", "message": "Too many requests"}}`, Throttled},
+		testCase{401, `{"error": {"code": "unauthenticated", "message": "Token expired"}}`, Unauthorized},
+		testCase{400, `{"error": {"code": "invalidRequest", "message": "Bad name",
+			"innererror": {"code": "invalidPath"}}}`, NameInvalid},
+	}
+
+	for idx, test := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(test.status)
+			fmt.Fprint(rw, test.body)
+		}))
+
+		api := NewOneDriveAPI(server.Client(), server.URL, "")
+		_, err := api.Quota()
+		server.Close()
+
+		if !errors.Is(err, test.expected) {
+			t.Errorf("test %d: expected %s, got %v", idx, test.expected, err)
+		}
+
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("test %d: expected an *Error, got %T", idx, err)
+		}
+		if apiErr.StatusCode != test.status {
+			t.Errorf("test %d: expected status %d, got %d", idx, test.status, apiErr.StatusCode)
+		}
+		for _, other := range []error{PathNotFound, Conflict, QuotaExceeded, Throttled, Unauthorized, NameInvalid} {
+			if other != test.expected && errors.Is(err, other) {
+				t.Errorf("test %d: %v unexpectedly matched %s", idx, err, other)
+			}
+		}
+	}
+}
+
+func TestErrorRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Retry-After", "7")
+		rw.WriteHeader(503)
+		fmt.Fprint(rw, "Service Unavailable")
+	}))
+	defer server.Close()
+
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+	_, err := api.Quota()
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *Error, got %T", err)
+	}
+	if apiErr.RetryAfter != 7*time.Second {
+		t.Errorf("expected Retry-After of 7s, got %s", apiErr.RetryAfter)
+	}
+	if apiErr.Message != "Service Unavailable" {
+		t.Errorf("expected the raw body as message, got %q", apiErr.Message)
+	}
+}
@@ -0,0 +1,575 @@
+package onedrive
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fakeDrive is an in-memory drive that understands path-based addressing
+// for the requests made by OneDriveAPI.
+type fakeDrive struct {
+	sync.Mutex                  // protects the fields below
+	items      map[string]*Item // keyed by path, "" is the root folder
+	requests   []string         // the escaped paths of all requests
+	changes    int              // incremented on every change, used for eTags
+	sessions   map[string]*fakeSession
+	contents   map[string][]byte        // the contents of files by id
+	perms      map[string][]*Permission // permissions granted on each path
+	batchError int                      // the status $batch fails with, if any
+	hook       func(*http.Request)      // called for every request, e.g. to change the drive
+}
+
+// fakeSession is an upload session in progress
+type fakeSession struct {
+	path string
+	item *Item
+	data []byte
+}
+
+func newFakeDrive() *fakeDrive {
+	return &fakeDrive{
+		items: map[string]*Item{
+			"": &Item{Id: "root", Name: "root", Folder: &Folder{}},
+		},
+		sessions: make(map[string]*fakeSession),
+		contents: make(map[string][]byte),
+		perms:    make(map[string][]*Permission),
+	}
+}
+
+// fakeAppFolder is the path of the app folder in the drive
+const fakeAppFolder = "Apps/cloud-backup"
+
+// parsePath splits an escaped request path of the form /drive/root,
+// /drive/root/action, /drive/root:/path or /drive/root:/path:/action into the
+// unescaped item path and the action. Paths below /drive/special/approot are
+// resolved in the app folder.
+func parsePath(escaped string) (string, string, error) {
+	var base, rest string
+	switch {
+	case strings.HasPrefix(escaped, "/drive/root"):
+		rest = strings.TrimPrefix(escaped, "/drive/root")
+	case strings.HasPrefix(escaped, "/drive/special/approot"):
+		base, rest = fakeAppFolder, strings.TrimPrefix(escaped, "/drive/special/approot")
+	default:
+		return "", "", fmt.Errorf("unknown path %s", escaped)
+	}
+
+	if rest == "" {
+		return base, "", nil
+	} else if strings.HasPrefix(rest, "/") {
+		return base, strings.TrimPrefix(rest, "/"), nil
+	} else if !strings.HasPrefix(rest, ":/") {
+		return "", "", fmt.Errorf("unknown path %s", escaped)
+	}
+
+	// any literal colon delimits the path, colons in names must be escaped
+	rest = strings.TrimPrefix(rest, ":/")
+	action := ""
+	if idx := strings.Index(rest, ":"); idx >= 0 {
+		rest, action = rest[:idx], strings.TrimPrefix(rest[idx:], ":/")
+	}
+	itemPath, err := url.PathUnescape(rest)
+	return strings.TrimPrefix(base+"/"+itemPath, "/"), action, err
+}
+
+// ensureAppFolder creates the app folder on first access
+func (d *fakeDrive) ensureAppFolder() {
+	if _, ok := d.items[fakeAppFolder]; ok {
+		return
+	}
+	if _, ok := d.items[parentOf(fakeAppFolder)]; !ok {
+		d.items[parentOf(fakeAppFolder)] = &Item{Id: "apps", Name: "Apps", Folder: &Folder{}}
+	}
+	d.items[fakeAppFolder] = &Item{
+		Id:              "approot",
+		Name:            path.Base(fakeAppFolder),
+		Folder:          &Folder{},
+		SpecialFolder:   &SpecialFolder{Name: "approot"},
+		ParentReference: &ItemReference{Path: "/drive/root:/" + parentOf(fakeAppFolder)},
+	}
+}
+
+func (d *fakeDrive) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/$batch" {
+		d.batch(rw, req)
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.requests = append(d.requests, req.URL.EscapedPath())
+	if d.hook != nil {
+		d.hook(req)
+	}
+
+	if req.URL.Path == "/drive" {
+		d.reply(rw, 200, &Drive{Id: "drive", DriveType: "personal"})
+		return
+	} else if strings.HasPrefix(req.URL.Path, "/upload/") {
+		d.uploadChunk(rw, req)
+		return
+	} else if strings.HasPrefix(req.URL.Path, "/download/") {
+		d.download(rw, req)
+		return
+	} else if strings.HasPrefix(req.URL.Path, "/thumbnail/") {
+		d.thumbnail(rw, req)
+		return
+	} else if strings.HasPrefix(req.URL.Path, "/drive/special/approot") {
+		d.ensureAppFolder()
+	}
+
+	itemPath, action, err := parsePath(req.URL.EscapedPath())
+	if err != nil {
+		d.fail(rw, 400, "invalidRequest", err.Error())
+		return
+	}
+
+	switch {
+	case req.Method == "GET" && action == "":
+		d.get(rw, itemPath)
+	case req.Method == "GET" && action == "children":
+		d.children(rw, itemPath)
+	case req.Method == "POST" && action == "children":
+		var payload struct {
+			Name             string `json:"name"`
+			ConflictBehavior string `json:"@microsoft.graph.conflictBehavior"`
+		}
+		json.NewDecoder(req.Body).Decode(&payload)
+		name := payload.Name
+		if payload.ConflictBehavior != "fail" {
+			// like the service, rename the folder if the name is taken
+			for idx := 1; d.items[strings.TrimPrefix(itemPath+"/"+name, "/")] != nil; idx++ {
+				name = fmt.Sprintf("%s %d", payload.Name, idx)
+			}
+		}
+		d.create(rw, itemPath, name, &Item{Folder: &Folder{}})
+	case req.Method == "PUT" && action == "content":
+		if !d.checkPreconditions(rw, req, itemPath) {
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		item := &Item{
+			Size: float64(len(body)),
+			File: &File{Hashes: &Hashes{Sha1Hash: fmt.Sprintf("%X", sha1.Sum(body))}},
+		}
+		if existing, ok := d.items[itemPath]; ok {
+			item.Id = existing.Id
+		}
+		d.create(rw, path.Dir(itemPath), path.Base(itemPath), item)
+		d.contents[item.Id] = body
+	case req.Method == "GET" && action == "content":
+		item, ok := d.items[itemPath]
+		if !ok || item.File == nil {
+			d.fail(rw, 404, "itemNotFound", "File does not exist")
+			return
+		}
+		http.Redirect(rw, req, "http://"+req.Host+"/download/"+item.Id, http.StatusFound)
+	case req.Method == "POST" && action == "createUploadSession":
+		var payload struct {
+			Item map[string]json.RawMessage `json:"item"`
+		}
+		json.NewDecoder(req.Body).Decode(&payload)
+		if _, exists := d.items[itemPath]; exists && string(payload.Item["@microsoft.graph.conflictBehavior"]) == `"fail"` {
+			d.fail(rw, 409, "nameAlreadyExists", "An item with the same name already exists")
+			return
+		}
+		if !d.checkPreconditions(rw, req, itemPath) {
+			return
+		}
+		item := &Item{}
+		json.Unmarshal(payload.Item["fileSystemInfo"], &item.FileSystemInfo)
+		id := fmt.Sprintf("%d", len(d.sessions))
+		d.sessions[id] = &fakeSession{path: itemPath, item: item}
+		d.reply(rw, 200, &UploadSession{UploadUrl: "http://" + req.Host + "/upload/" + id})
+	case req.Method == "PATCH" && action == "":
+		if !d.checkPreconditions(rw, req, itemPath) {
+			return
+		}
+		var payload Item
+		json.NewDecoder(req.Body).Decode(&payload)
+		item := d.items[itemPath]
+		if payload.FileSystemInfo != nil {
+			item.FileSystemInfo = payload.FileSystemInfo
+		}
+		name := item.Name
+		if payload.Name != "" {
+			name = payload.Name
+		}
+		delete(d.items, itemPath)
+		d.create(rw, parentOf(itemPath), name, item)
+	case req.Method == "DELETE" && action == "":
+		if !d.checkPreconditions(rw, req, itemPath) {
+			return
+		}
+		delete(d.items, itemPath)
+		rw.WriteHeader(204)
+	case req.Method == "POST" && action == "createLink":
+		var payload struct {
+			Type string `json:"type"`
+		}
+		json.NewDecoder(req.Body).Decode(&payload)
+		d.createLink(rw, itemPath, payload.Type)
+	case req.Method == "GET" && strings.HasPrefix(action, "search("):
+		d.search(rw, req, itemPath, action)
+	case req.Method == "GET" && action == "thumbnails":
+		d.thumbnails(rw, req, itemPath)
+	case req.Method == "GET" && strings.HasPrefix(action, "thumbnails/0/"):
+		item, ok := d.items[itemPath]
+		if !ok || item.File == nil {
+			d.fail(rw, 404, "itemNotFound", "Item has no thumbnails")
+			return
+		}
+		size := strings.TrimSuffix(strings.TrimPrefix(action, "thumbnails/0/"), "/content")
+		http.Redirect(rw, req, "http://"+req.Host+"/thumbnail/"+size+"/"+item.File.Hashes.Sha1Hash, http.StatusFound)
+	case req.Method == "GET" && action == "permissions":
+		d.permissions(rw, itemPath)
+	case req.Method == "DELETE" && strings.HasPrefix(action, "permissions/"):
+		d.deletePermission(rw, itemPath, strings.TrimPrefix(action, "permissions/"))
+	default:
+		d.fail(rw, 400, "invalidRequest", "unsupported request "+req.Method+" "+action)
+	}
+}
+
+// batch serves the sub-requests of a JSON batch one after the other, and
+// fails those that depend on a request that failed.
+func (d *fakeDrive) batch(rw http.ResponseWriter, req *http.Request) {
+	d.Lock()
+	d.requests = append(d.requests, req.URL.EscapedPath())
+	batchError := d.batchError
+	d.Unlock()
+	if batchError != 0 {
+		d.fail(rw, batchError, "notSupported", "JSON batching is not supported")
+		return
+	}
+
+	var payload struct {
+		Requests []*BatchRequest `json:"requests"`
+	}
+	json.NewDecoder(req.Body).Decode(&payload)
+	if len(payload.Requests) > maxBatchSize {
+		d.fail(rw, 400, "invalidRequest", "Too many requests in batch")
+		return
+	}
+
+	status := make(map[string]int)
+	responses := []*BatchResponse{}
+	for _, sub := range payload.Requests {
+		failed := false
+		for _, dep := range sub.DependsOn {
+			if status[dep] == 0 || status[dep] >= 300 {
+				failed = true
+			}
+		}
+		if failed {
+			status[sub.Id] = http.StatusFailedDependency
+			responses = append(responses, &BatchResponse{Id: sub.Id, Status: http.StatusFailedDependency})
+			continue
+		}
+
+		subReq := httptest.NewRequest(sub.Method, sub.URL, bytes.NewReader(sub.Body))
+		subReq.Host = req.Host
+		for key, value := range sub.Headers {
+			subReq.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		d.ServeHTTP(recorder, subReq)
+		status[sub.Id] = recorder.Code
+
+		response := &BatchResponse{Id: sub.Id, Status: recorder.Code}
+		if recorder.Body.Len() > 0 {
+			response.Body = recorder.Body.Bytes()
+		}
+		responses = append(responses, response)
+	}
+	d.reply(rw, 200, map[string]interface{}{"responses": responses})
+}
+
+// uploadChunk appends a chunk to an upload session, creating the file once
+// all of it has been received.
+func (d *fakeDrive) uploadChunk(rw http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/upload/")
+	session, ok := d.sessions[id]
+	if !ok {
+		d.fail(rw, 404, "itemNotFound", "Upload session does not exist")
+		return
+	} else if req.Header.Get("Authorization") != "" {
+		d.fail(rw, 401, "unauthenticated", "Upload URLs must not be sent credentials")
+		return
+	} else if req.Method == "DELETE" {
+		delete(d.sessions, id)
+		rw.WriteHeader(204)
+		return
+	} else if req.Method == "GET" {
+		d.reply(rw, 200, &UploadSession{NextExpectedRanges: []string{fmt.Sprintf("%d-", len(session.data))}})
+		return
+	}
+
+	var start, end, size int
+	fmt.Sscanf(req.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+	body, _ := ioutil.ReadAll(req.Body)
+	if start != len(session.data) || end != start+len(body)-1 {
+		d.fail(rw, 416, "invalidRange", "Unexpected range "+req.Header.Get("Content-Range"))
+		return
+	}
+	session.data = append(session.data, body...)
+	if len(session.data) < size {
+		d.reply(rw, 202, &UploadSession{NextExpectedRanges: []string{fmt.Sprintf("%d-", len(session.data))}})
+		return
+	}
+
+	delete(d.sessions, id)
+	item := session.item
+	item.Size = float64(len(session.data))
+	item.File = &File{Hashes: &Hashes{Sha1Hash: fmt.Sprintf("%X", sha1.Sum(session.data))}}
+	if existing, ok := d.items[session.path]; ok {
+		item.Id = existing.Id
+	}
+	d.create(rw, parentOf(session.path), path.Base(session.path), item)
+	d.contents[item.Id] = session.data
+}
+
+// download serves the contents of a file from its pre-authenticated URL
+func (d *fakeDrive) download(rw http.ResponseWriter, req *http.Request) {
+	contents, ok := d.contents[strings.TrimPrefix(req.URL.Path, "/download/")]
+	if !ok {
+		d.fail(rw, 404, "itemNotFound", "File does not exist")
+		return
+	} else if req.Header.Get("Authorization") != "" {
+		d.fail(rw, 401, "unauthenticated", "Download URLs must not be sent credentials")
+		return
+	}
+	rw.Write(contents)
+}
+
+// checkPreconditions fails the request if the item does not match If-Match,
+// or if it exists and the conflict behaviour is fail.
+func (d *fakeDrive) checkPreconditions(rw http.ResponseWriter, req *http.Request, itemPath string) bool {
+	item, exists := d.items[itemPath]
+	if req.FormValue("@microsoft.graph.conflictBehavior") == "fail" && exists {
+		d.fail(rw, 409, "nameAlreadyExists", "An item with the same name already exists")
+		return false
+	}
+	if eTag := req.Header.Get("If-Match"); eTag != "" && (!exists || item.ETag != eTag) {
+		d.fail(rw, 412, "resourceModified", "The resource has been modified")
+		return false
+	}
+	if (req.Method == "PATCH" || req.Method == "DELETE") && !exists {
+		d.fail(rw, 404, "itemNotFound", "Item does not exist")
+		return false
+	}
+	return true
+}
+
+func (d *fakeDrive) get(rw http.ResponseWriter, itemPath string) {
+	item, ok := d.items[itemPath]
+	if !ok {
+		d.fail(rw, 404, "itemNotFound", "Item does not exist")
+		return
+	}
+	d.reply(rw, 200, item)
+}
+
+func (d *fakeDrive) children(rw http.ResponseWriter, itemPath string) {
+	if _, ok := d.items[itemPath]; !ok {
+		d.fail(rw, 404, "itemNotFound", "Item does not exist")
+		return
+	}
+
+	response := &ViewChanges{Value: []*Item{}}
+	for childPath, item := range d.items {
+		if childPath != "" && parentOf(childPath) == itemPath {
+			response.Value = append(response.Value, item)
+		}
+	}
+	d.reply(rw, 200, response)
+}
+
+// create adds the item below the parent folder, files replace existing files
+func (d *fakeDrive) create(rw http.ResponseWriter, parent, name string, item *Item) {
+	if parent == "." {
+		parent = ""
+	}
+	if folder, ok := d.items[parent]; !ok || folder.Folder == nil {
+		d.fail(rw, 404, "itemNotFound", "Parent does not exist")
+		return
+	}
+
+	itemPath := strings.TrimPrefix(parent+"/"+name, "/")
+	if existing, ok := d.items[itemPath]; ok && (existing.Folder != nil || item.Folder != nil) {
+		d.fail(rw, 409, "nameAlreadyExists", "An item with the same name already exists")
+		return
+	}
+
+	d.changes++
+	if item.Id == "" {
+		item.Id = fmt.Sprintf("item%d", d.changes)
+	}
+	item.Name = name
+	item.ETag = fmt.Sprintf("\"{%s},%d\"", item.Id, d.changes)
+	if item.CTag == "" {
+		// only new contents get a new cTag
+		item.CTag = fmt.Sprintf("\"c:{%s},%d\"", item.Id, d.changes)
+	}
+	d.items[itemPath] = item
+	d.reply(rw, 201, item)
+}
+
+// searchPageSize is the number of search results returned per page
+const searchPageSize = 2
+
+// search returns the items below itemPath whose name contains the query of
+// the action search(q='query'), a page at a time.
+func (d *fakeDrive) search(rw http.ResponseWriter, req *http.Request, itemPath, action string) {
+	literal, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(action, "search(q='"), "')"))
+	if err != nil {
+		d.fail(rw, 400, "invalidRequest", err.Error())
+		return
+	}
+	query := strings.ToLower(strings.Replace(literal, "''", "'", -1))
+
+	var matches []string
+	for childPath, item := range d.items {
+		inside := itemPath == "" || strings.HasPrefix(childPath, itemPath+"/")
+		if childPath != "" && inside && strings.Contains(strings.ToLower(item.Name), query) {
+			matches = append(matches, childPath)
+		}
+	}
+	sort.Strings(matches)
+
+	var skip int
+	fmt.Sscanf(req.FormValue("$skiptoken"), "%d", &skip)
+	response := &ViewChanges{Value: []*Item{}}
+	for idx := skip; idx < len(matches) && idx < skip+searchPageSize; idx++ {
+		found := *d.items[matches[idx]]
+		found.ParentReference = &ItemReference{Path: "/drive/root:/" + escapePath(parentOf(matches[idx]))}
+		response.Value = append(response.Value, &found)
+	}
+	if skip+searchPageSize < len(matches) {
+		response.Instanceodata_nextLink = fmt.Sprintf("http://%s%s?$skiptoken=%d", req.Host, req.URL.EscapedPath(), skip+searchPageSize)
+	}
+	d.reply(rw, 200, response)
+}
+
+// thumbnails lists the default thumbnail set of a file
+func (d *fakeDrive) thumbnails(rw http.ResponseWriter, req *http.Request, itemPath string) {
+	item, ok := d.items[itemPath]
+	if !ok {
+		d.fail(rw, 404, "itemNotFound", "Item does not exist")
+		return
+	}
+
+	response := &thumbnailSetList{Value: []*ThumbnailSet{}}
+	if item.File != nil {
+		thumbnail := func(size string) *Thumbnail {
+			return &Thumbnail{Url: "http://" + req.Host + req.URL.Path + "/0/" + size + "/content"}
+		}
+		response.Value = append(response.Value, &ThumbnailSet{
+			Id:     "0",
+			Small:  thumbnail(SmallThumbnail),
+			Medium: thumbnail(MediumThumbnail),
+			Large:  thumbnail(LargeThumbnail),
+		})
+	}
+	d.reply(rw, 200, response)
+}
+
+// thumbnail serves a thumbnail derived from the hash of the contents of a
+// file from its pre-authenticated URL
+func (d *fakeDrive) thumbnail(rw http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "" {
+		d.fail(rw, 401, "unauthenticated", "Thumbnail URLs must not be sent credentials")
+		return
+	}
+	var size, hash string
+	fmt.Sscanf(strings.Replace(strings.TrimPrefix(req.URL.Path, "/thumbnail/"), "/", " ", 1), "%s %s", &size, &hash)
+	rw.Header().Set("Content-Type", "image/jpeg")
+	fmt.Fprintf(rw, "%s thumbnail of %s", size, hash)
+}
+
+// createLink returns the sharing link of the given type on the item, creating
+// it if it doesn't exist yet
+func (d *fakeDrive) createLink(rw http.ResponseWriter, itemPath, linkType string) {
+	if _, ok := d.items[itemPath]; !ok {
+		d.fail(rw, 404, "itemNotFound", "Item does not exist")
+		return
+	}
+	for _, perm := range d.perms[itemPath] {
+		if perm.Link != nil && perm.Link.Type == linkType {
+			d.reply(rw, 200, perm)
+			return
+		}
+	}
+
+	d.changes++
+	role := "read"
+	if linkType == "edit" {
+		role = "write"
+	}
+	id := fmt.Sprintf("perm%d", d.changes)
+	perm := &Permission{
+		Id:    id,
+		Roles: []string{role},
+		Link:  &SharingLink{Type: linkType, WebUrl: "https://1drv.ms/" + id},
+	}
+	d.perms[itemPath] = append(d.perms[itemPath], perm)
+	d.reply(rw, 201, perm)
+}
+
+// permissions lists the permissions of the item and those of its ancestors
+func (d *fakeDrive) permissions(rw http.ResponseWriter, itemPath string) {
+	if _, ok := d.items[itemPath]; !ok {
+		d.fail(rw, 404, "itemNotFound", "Item does not exist")
+		return
+	}
+
+	response := &permissionList{Value: d.perms[itemPath]}
+	for ancestor := itemPath; ancestor != ""; {
+		ancestor = parentOf(ancestor)
+		for _, perm := range d.perms[ancestor] {
+			inherited := *perm
+			inherited.InheritedFrom = &ItemReference{Id: d.items[ancestor].Id, Path: "/drive/root:/" + ancestor}
+			response.Value = append(response.Value, &inherited)
+		}
+	}
+	d.reply(rw, 200, response)
+}
+
+func (d *fakeDrive) deletePermission(rw http.ResponseWriter, itemPath, id string) {
+	perms := d.perms[itemPath]
+	for idx, perm := range perms {
+		if perm.Id == id {
+			d.perms[itemPath] = append(perms[:idx], perms[idx+1:]...)
+			rw.WriteHeader(204)
+			return
+		}
+	}
+	d.fail(rw, 404, "itemNotFound", "Permission does not exist")
+}
+
+func (d *fakeDrive) reply(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+func (d *fakeDrive) fail(rw http.ResponseWriter, status int, code, message string) {
+	d.reply(rw, status, map[string]*Error{"error": &Error{Code: code, Message: message}})
+}
+
+func parentOf(itemPath string) string {
+	parent := path.Dir(itemPath)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
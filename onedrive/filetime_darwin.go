@@ -0,0 +1,16 @@
+package onedrive
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileCreationTime returns the birth time of a local file, if known
+func fileCreationTime(fi os.FileInfo) (time.Time, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
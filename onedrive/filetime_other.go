@@ -0,0 +1,14 @@
+//go:build !darwin && !windows
+
+package onedrive
+
+import (
+	"os"
+	"time"
+)
+
+// fileCreationTime returns the creation time of a local file, which is not
+// available through the standard library on this system.
+func fileCreationTime(fi os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
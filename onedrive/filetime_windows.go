@@ -0,0 +1,16 @@
+package onedrive
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileCreationTime returns the creation time of a local file, if known
+func fileCreationTime(fi os.FileInfo) (time.Time, bool) {
+	attrs, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, attrs.CreationTime.Nanoseconds()), true
+}
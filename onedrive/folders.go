@@ -0,0 +1,120 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// folderCache remembers remote folders that are known to exist
+type folderCache struct {
+	sync.Mutex // protects folders
+	folders    map[string]*Item
+}
+
+func (c *folderCache) get(folder string) *Item {
+	c.Lock()
+	defer c.Unlock()
+	return c.folders[folder]
+}
+
+func (c *folderCache) put(folder string, item *Item) {
+	c.Lock()
+	defer c.Unlock()
+	if c.folders == nil {
+		c.folders = make(map[string]*Item)
+	}
+	c.folders[folder] = item
+}
+
+func (api *OneDriveAPI) EnsureFolder(folder string) (*Item, error) {
+	return api.EnsureFolderContext(context.Background(), folder)
+}
+
+// EnsureFolderContext makes sure the folder and all of its ancestors exist,
+// creating any that are missing, and returns the folder. The ancestors that
+// aren't known yet are looked up in a single batch, and the missing ones are
+// created in another. It is safe to call concurrently for overlapping paths:
+// a folder that is created by someone else in the meantime is simply looked
+// up again.
+func (api *OneDriveAPI) EnsureFolderContext(ctx context.Context, folder string) (*Item, error) {
+	folder = strings.Trim(path.Clean("/"+folder), "/")
+	if item := api.folders.get(folder); item != nil {
+		return item, nil
+	}
+
+	// the folder and its unknown ancestors, parents before their children
+	var unknown []string
+	for ancestor := folder; api.folders.get(ancestor) == nil; ancestor = parentFolder(ancestor) {
+		unknown = append([]string{ancestor}, unknown...)
+		if ancestor == "" {
+			break
+		}
+	}
+
+	// every folder below the first missing one is missing too
+	results, err := api.MetadataBatch(ctx, unknown)
+	if err != nil {
+		return nil, err
+	}
+	missing := len(unknown)
+	for idx, result := range results {
+		if errors.Is(result.Err, PathNotFound) {
+			missing = idx
+			break
+		}
+		if err := api.knownFolder(unknown[idx], result.Item, result.Err); err != nil {
+			return nil, err
+		}
+	}
+	if missing == len(unknown) {
+		return api.folders.get(folder), nil
+	}
+
+	created, err := api.MkdirBatch(ctx, unknown[missing:])
+	if err != nil {
+		return nil, err
+	}
+	for idx, result := range created {
+		item, err := result.Item, result.Err
+		var apiErr *Error
+		if errors.Is(err, Conflict) {
+			// created by another worker (or machine) since we looked
+			item, err = api.MetadataContext(ctx, unknown[missing+idx])
+		} else if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusFailedDependency {
+			// the parent was created by someone else and is known now, so
+			// the remaining folders are created in another batch
+			return api.EnsureFolderContext(ctx, folder)
+		}
+		if err := api.knownFolder(unknown[missing+idx], item, err); err != nil {
+			return nil, err
+		}
+	}
+	return api.folders.get(folder), nil
+}
+
+// knownFolder remembers the item of a folder that was looked up or created,
+// unless that failed or the item is not a folder.
+func (api *OneDriveAPI) knownFolder(folder string, item *Item, err error) error {
+	if err != nil {
+		return err
+	}
+	if item.Folder == nil {
+		return fmt.Errorf("Remote path %q is not a folder", folder)
+	}
+	api.folders.put(folder, item)
+	return nil
+}
+
+// parentFolder returns the parent of a folder, "" being the root folder
+func parentFolder(folder string) string {
+	parent := path.Dir(folder)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
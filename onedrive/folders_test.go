@@ -0,0 +1,90 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureFolder(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	item, err := api.EnsureFolderContext(context.Background(), "/Backups/2015/Summer/")
+	if err != nil {
+		t.Fatalf("failed when creating nested folders: %s", err)
+	}
+	if item.Name != "Summer" || item.Folder == nil {
+		t.Fatalf("expected the Summer folder, got %#v", item)
+	}
+	for _, folder := range []string{"Backups", "Backups/2015", "Backups/2015/Summer"} {
+		if drive.items[folder] == nil || drive.items[folder].Folder == nil {
+			t.Errorf("expected folder %s to be created", folder)
+		}
+	}
+
+	// the folders are looked up in one batch and created in another
+	batches := 0
+	for _, request := range drive.requests {
+		if request == "/$batch" {
+			batches++
+		}
+	}
+	if batches != 2 {
+		t.Errorf("expected 2 batches, got %d in %v", batches, drive.requests)
+	}
+
+	// known folders are served from the cache
+	requests := len(drive.requests)
+	if _, err := api.EnsureFolder("Backups/2015"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(drive.requests) != requests {
+		t.Errorf("expected no requests for a cached folder, got %v", drive.requests[requests:])
+	}
+
+	// a folder created by someone else is not an error
+	other := NewOneDriveAPI(server.Client(), server.URL, "")
+	if _, err := other.Mkdir("Backups/2015", "Winter"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := api.EnsureFolder("Backups/2015/Winter"); err != nil {
+		t.Errorf("expected existing folder to be found, got %s", err)
+	}
+
+	// a folder created by someone else between looking it up and creating it
+	// is looked up again, rather than created with another name, and its
+	// children are created in it
+	drive.hook = func(req *http.Request) {
+		if req.Method == "POST" && drive.items["Backups/2015/Autumn"] == nil {
+			drive.items["Backups/2015/Autumn"] = &Item{Id: "autumn", Name: "Autumn", Folder: &Folder{}}
+		}
+	}
+	item, err = api.EnsureFolder("Backups/2015/Autumn/Leaves")
+	drive.hook = nil
+	if err != nil || item.Name != "Leaves" {
+		t.Fatalf("expected the Leaves folder, got %#v (%v)", item, err)
+	}
+	if drive.items["Backups/2015/Autumn 1"] != nil || drive.items["Backups/2015/Autumn/Leaves"] == nil {
+		t.Errorf("expected Leaves to be created in the existing Autumn folder")
+	}
+	if _, err := api.Mkdir("Backups/2015", "Autumn"); !errors.Is(err, Conflict) {
+		t.Errorf("expected creating an existing folder to conflict, got %v", err)
+	}
+
+	// files can't be used as folders
+	local := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(local, []byte("contents"), 0644)
+	if _, err := api.Upload(local, "Backups/file"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := api.EnsureFolder("Backups/file"); err == nil {
+		t.Errorf("expected an error when a file is in the way")
+	}
+}
@@ -0,0 +1,88 @@
+package onedrive
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// MicrosoftLoginURL is the Microsoft identity platform
+const MicrosoftLoginURL = "https://login.microsoftonline.com"
+
+// The tenants that aren't a directory of their own
+const (
+	CommonTenant        = "common"        // work, school and personal accounts
+	ConsumersTenant     = "consumers"     // personal accounts only
+	OrganizationsTenant = "organizations" // work and school accounts only
+)
+
+var (
+	tenantID     = regexp.MustCompile(`^[0-9a-fA-F]{8}-([0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}$`)
+	tenantDomain = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.)+[A-Za-z]{2,}$`)
+)
+
+// validateTenant checks that the tenant is one of the presets, a directory
+// id or a domain name such as contoso.onmicrosoft.com.
+func validateTenant(tenant string) error {
+	switch {
+	case tenant == CommonTenant || tenant == ConsumersTenant || tenant == OrganizationsTenant:
+		return nil
+	case tenantID.MatchString(tenant) || tenantDomain.MatchString(tenant):
+		return nil
+	}
+	return fmt.Errorf("Invalid tenant %q, expected %s, %s, %s, a tenant id or a domain",
+		tenant, CommonTenant, ConsumersTenant, OrganizationsTenant)
+}
+
+// MicrosoftEndpoint returns the Microsoft identity platform v2 endpoints of
+// the tenant.
+func MicrosoftEndpoint(tenant string) (oauth2.Endpoint, error) {
+	if err := validateTenant(tenant); err != nil {
+		return oauth2.Endpoint{}, err
+	}
+	base := MicrosoftLoginURL + "/" + tenant + "/oauth2/v2.0"
+	return oauth2.Endpoint{
+		AuthURL:  base + "/authorize",
+		TokenURL: base + "/token",
+	}, nil
+}
+
+// MicrosoftDeviceEndpoint returns the device authorization endpoint of the
+// tenant, see DeviceToken.
+func MicrosoftDeviceEndpoint(tenant string) (string, error) {
+	if err := validateTenant(tenant); err != nil {
+		return "", err
+	}
+	return MicrosoftLoginURL + "/" + tenant + "/oauth2/v2.0/devicecode", nil
+}
+
+// MicrosoftConfig returns the configuration of an application registered
+// with the Microsoft identity platform. Public client applications, such as
+// desktop apps, have no client secret. The identity platform only grants
+// scopes of Microsoft Graph, not the Live scopes of the OneDrive API.
+func MicrosoftConfig(tenant, clientID, clientSecret string, scopes []string) (*oauth2.Config, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("No client id, register an application with the Microsoft identity platform and use its application id")
+	}
+	for _, scope := range scopes {
+		if strings.HasPrefix(scope, "wl.") || strings.HasPrefix(scope, "onedrive.") {
+			return nil, fmt.Errorf("The Microsoft identity platform doesn't grant the OneDrive API scope %q, use Microsoft Graph", scope)
+		}
+	}
+	endpoint, err := MicrosoftEndpoint(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if clientSecret == "" {
+		// public clients identify themselves in the request instead
+		endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		Endpoint:     endpoint,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package onedrive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestMicrosoftEndpoint(t *testing.T) {
+	type testCase struct {
+		tenant   string
+		expected string
+		err      bool
+	}
+
+	testCases := []testCase{
+		testCase{"common", "https://login.microsoftonline.com/common/oauth2/v2.0/token", false},
+		testCase{"consumers", "https://login.microsoftonline.com/consumers/oauth2/v2.0/token", false},
+		testCase{"organizations", "https://login.microsoftonline.com/organizations/oauth2/v2.0/token", false},
+		testCase{"8eaef023-2b34-4da1-9baa-8bc8c9d6a490", "https://login.microsoftonline.com/8eaef023-2b34-4da1-9baa-8bc8c9d6a490/oauth2/v2.0/token", false},
+		testCase{"contoso.onmicrosoft.com", "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/token", false},
+		testCase{"", "", true},
+		testCase{"contoso", "", true},
+		testCase{"common/../evil", "", true},
+	}
+
+	for _, test := range testCases {
+		endpoint, err := MicrosoftEndpoint(test.tenant)
+		if test.err && err == nil {
+			t.Errorf("%q: expected an error, got %q", test.tenant, endpoint.TokenURL)
+		} else if !test.err && (err != nil || endpoint.TokenURL != test.expected) {
+			t.Errorf("%q: expected %q, got %q (%v)", test.tenant, test.expected, endpoint.TokenURL, err)
+		}
+	}
+
+	device, err := MicrosoftDeviceEndpoint("common")
+	if err != nil || device != MicrosoftDeviceAuthURL {
+		t.Errorf("expected %q, got %q (%v)", MicrosoftDeviceAuthURL, device, err)
+	}
+}
+
+func TestMicrosoftConfig(t *testing.T) {
+	config, err := MicrosoftConfig("consumers", "client", "", DefaultScopes(GraphBaseURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientID != "client" || config.Endpoint.AuthStyle != oauth2.AuthStyleInParams {
+		t.Errorf("expected a public client, got %+v", config)
+	}
+	if !strings.HasPrefix(config.Endpoint.AuthURL, MicrosoftLoginURL+"/consumers/") {
+		t.Errorf("unexpected authorization endpoint %q", config.Endpoint.AuthURL)
+	}
+
+	config, err = MicrosoftConfig("common", "client", "secret", nil)
+	if err != nil || config.Endpoint.AuthStyle != oauth2.AuthStyleAutoDetect {
+		t.Errorf("expected a confidential client, got %+v (%v)", config, err)
+	}
+
+	if _, err := MicrosoftConfig("common", "", "", nil); err == nil {
+		t.Errorf("expected an error without a client id")
+	}
+	if _, err := MicrosoftConfig("common", "client", "", DefaultScopes(OneDriveBaseURL)); err == nil {
+		t.Errorf("expected an error for the scopes of the OneDrive API")
+	}
+}
+
+func TestOAuthConfigFromFile(t *testing.T) {
+	type testCase struct {
+		contents string
+		err      string // part of the expected error, if any
+	}
+
+	testCases := []testCase{
+		testCase{`{"installed": {"client_id": "id", "client_secret": "secret", "auth_uri": "https://example.com/auth", "token_uri": "https://example.com/token"}}`, ""},
+		testCase{`{"installed": {"client_id": "id", "auth_uri": "https://example.com/auth", "token_uri": "http://localhost:8080/token"}}`, ""},
+		testCase{`{"installed": `, "decode"},
+		testCase{`{"web": {}}`, `"installed"`},
+		testCase{`{"installed": {"auth_uri": "https://example.com/auth", "token_uri": "https://example.com/token"}}`, `"client_id"`},
+		testCase{`{"installed": {"client_id": "id", "token_uri": "https://example.com/token"}}`, `"auth_uri"`},
+		testCase{`{"installed": {"client_id": "id", "auth_uri": "https://example.com/auth", "token_uri": "token"}}`, `"token_uri" is not a URL`},
+		testCase{`{"installed": {"client_id": "id", "auth_uri": "http://example.com/auth", "token_uri": "https://example.com/token"}}`, `"auth_uri" must use https`},
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "client_secrets.json")
+	for _, test := range testCases {
+		if err := os.WriteFile(filename, []byte(test.contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		config, err := OAuthConfigFromFile(filename, nil)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.contents, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected an error about %s, got %v", test.contents, test.err, err)
+		} else if test.err == "" && config.ClientID != "id" {
+			t.Errorf("%s: unexpected config %+v", test.contents, config)
+		}
+	}
+
+	if _, err := OAuthConfigFromFile(filepath.Join(dir, "missing.json"), nil); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestClientSecretsDeviceAuthURL(t *testing.T) {
+	type testCase struct {
+		tokenURI, deviceAuthURI string
+		expected                string // empty if there is none
+	}
+
+	testCases := []testCase{
+		testCase{"https://example.com/token", "https://example.com/device", "https://example.com/device"},
+		testCase{"https://login.microsoftonline.com/common/oauth2/v2.0/token", "", MicrosoftDeviceAuthURL},
+		testCase{"https://login.microsoftonline.com/contoso.com/oauth2/v2.0/token", "", "https://login.microsoftonline.com/contoso.com/oauth2/v2.0/devicecode"},
+		testCase{"https://login.live.com/oauth20_token.srf", "", ""},
+		testCase{"https://login.microsoftonline.com/common/oauth2/token", "", ""},
+		testCase{"https://login.microsoftonline.com/not a tenant/oauth2/v2.0/token", "", ""},
+	}
+
+	for _, test := range testCases {
+		var secrets ClientSecrets
+		json.Unmarshal([]byte(fmt.Sprintf(`{"installed": {"client_id": "id", "auth_uri": "https://example.com/auth", "token_uri": %q, "device_auth_uri": %q}}`,
+			test.tokenURI, test.deviceAuthURI)), &secrets)
+		deviceAuthURL, err := secrets.DeviceAuthURL()
+		if test.expected == "" && err == nil {
+			t.Errorf("%s: expected an error, got %q", test.tokenURI, deviceAuthURL)
+		} else if test.expected != "" && (err != nil || deviceAuthURL != test.expected) {
+			t.Errorf("%s: expected %q, got %q (%v)", test.tokenURI, test.expected, deviceAuthURL, err)
+		}
+	}
+}
@@ -1,10 +1,15 @@
-package main
+package onedrive
 
 import (
-	"encoding/gob"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
@@ -13,7 +18,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,126 +26,317 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// DefaultRedirectHost and DefaultRedirectPort make up the redirect URL of
+// configurations without one, see RedirectURL.
+const (
+	DefaultRedirectHost = "localtest.me"
+	DefaultRedirectPort = "31337"
+)
+
+// RedirectURL returns the URL the browser is sent to after the user has
+// authorized the application, which is served on the port of this machine.
+// It is the RedirectURL of the OAuth configuration.
+func RedirectURL(host, port string) string {
+	return fmt.Sprintf("http://%s/", net.JoinHostPort(host, port))
+}
+
+// ClientSecrets is a client secrets file as downloaded from the Google API
+// console, which is also used for other OAuth providers
 type ClientSecrets struct {
-	Installed struct {
+	Installed *struct {
 		Client_id     string `json:"client_id"`
 		Client_secret string `json:"client_secret"`
 		Auth_uri      string `json:"auth_uri"`
 		Token_uri     string `json:"token_uri"`
+		Revoke_uri    string `json:"revoke_uri"` // optional, see Options.RevokeURL
+
+		// optional, see Options.DeviceAuthURL
+		Device_auth_uri string `json:"device_auth_uri"`
 	} `json:"installed"`
 }
 
-func OAuthConfigFromFile(filename string, scopes []string) *oauth2.Config {
-	// Fetch the secrets from the JSON file
+// Validate explains what is wrong with the secrets, if anything. The client
+// secret is optional for public clients.
+func (s *ClientSecrets) Validate() error {
+	if s.Installed == nil {
+		return fmt.Errorf(`missing the "installed" object`)
+	}
+	if s.Installed.Client_id == "" {
+		return fmt.Errorf(`missing "client_id"`)
+	}
+	for _, field := range []struct {
+		name, value string
+		optional    bool
+	}{
+		{"auth_uri", s.Installed.Auth_uri, false},
+		{"token_uri", s.Installed.Token_uri, false},
+		{"revoke_uri", s.Installed.Revoke_uri, true},
+		{"device_auth_uri", s.Installed.Device_auth_uri, true},
+	} {
+		if field.value == "" && field.optional {
+			continue
+		} else if field.value == "" {
+			return fmt.Errorf("missing %q", field.name)
+		}
+		parsed, err := url.Parse(field.value)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			return fmt.Errorf("%q is not a URL: %q", field.name, field.value)
+		} else if parsed.Scheme == "http" && parsed.Hostname() != "localhost" && parsed.Hostname() != "127.0.0.1" {
+			return fmt.Errorf("%q must use https: %q", field.name, field.value)
+		}
+	}
+	return nil
+}
+
+// DeviceAuthURL returns the device authorization endpoint that belongs to the
+// token endpoint of the secrets, which is the device_auth_uri if there is
+// one. Otherwise it can only be derived for a tenant of the Microsoft
+// identity platform.
+func (s *ClientSecrets) DeviceAuthURL() (string, error) {
+	if s.Installed.Device_auth_uri != "" {
+		return s.Installed.Device_auth_uri, nil
+	}
+	const tokenPath = "/oauth2/v2.0/token"
+	if strings.HasPrefix(s.Installed.Token_uri, MicrosoftLoginURL+"/") && strings.HasSuffix(s.Installed.Token_uri, tokenPath) {
+		tenant := strings.TrimSuffix(strings.TrimPrefix(s.Installed.Token_uri, MicrosoftLoginURL+"/"), tokenPath)
+		return MicrosoftDeviceEndpoint(tenant)
+	}
+	return "", fmt.Errorf(`No device authorization endpoint for %s, add a "device_auth_uri" to the client secrets`, s.Installed.Token_uri)
+}
+
+// ReadClientSecrets reads and validates a client secrets file
+func ReadClientSecrets(filename string) (*ClientSecrets, error) {
 	var secrets ClientSecrets
 	contents, err := ioutil.ReadFile(filename)
 	if err != nil {
-		log.Fatalf("Error reading %q: %v", filename, err)
+		return nil, err
 	}
 	err = json.Unmarshal(contents, &secrets)
 	if err != nil {
-		log.Fatalf("Could not decode client credentials: %v", err)
+		return nil, fmt.Errorf("Could not decode client secrets in %s: %w", filename, err)
 	}
+	if err := secrets.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid client secrets in %s: %w", filename, err)
+	}
+	return &secrets, nil
+}
 
-	return &oauth2.Config{
-		ClientID:     secrets.Installed.Client_id,
-		ClientSecret: secrets.Installed.Client_secret,
+// Config returns the client configuration for the scopes
+func (s *ClientSecrets) Config(scopes []string) *oauth2.Config {
+	config := &oauth2.Config{
+		ClientID:     s.Installed.Client_id,
+		ClientSecret: s.Installed.Client_secret,
 		Scopes:       scopes,
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  secrets.Installed.Auth_uri,
-			TokenURL: secrets.Installed.Token_uri,
+			AuthURL:  s.Installed.Auth_uri,
+			TokenURL: s.Installed.Token_uri,
 		},
 	}
+	if config.ClientSecret == "" {
+		config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+	return config
+}
+
+// OAuthConfigFromFile reads the client configuration from a client secrets
+// file, see ClientSecrets.
+func OAuthConfigFromFile(filename string, scopes []string) (*oauth2.Config, error) {
+	secrets, err := ReadClientSecrets(filename)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Config(scopes), nil
 }
 
 // tokenCacheFilename returns the local cache filename for a given oauth
-// configuration tuple (id, secret, scope).
-func tokenCacheFilename(appName string, config *oauth2.Config) string {
+// configuration tuple (id, secret, scope). The token directory is created if
+// needed in home, see UserDirs, and a token cached in the legacy directory is
+// moved there.
+func tokenCacheFilename(appName string, config *oauth2.Config, home string) (string, error) {
 	hash := fnv.New32a()
 	hash.Write([]byte(config.ClientID))
 	hash.Write([]byte(config.ClientSecret))
 	scopes := strings.Join(config.Scopes, ",")
 	hash.Write([]byte(scopes))
 	fn := fmt.Sprintf("%s-token%v", appName, hash.Sum32())
-	return filepath.Join(osUserCacheDir(), url.QueryEscape(fn))
-}
 
-// osUserCacheDir returns the cache directory used for oAuth tokens depending
-// on operating system.
-func osUserCacheDir() string {
-	switch runtime.GOOS {
-	case "darwin":
-		return filepath.Join(os.Getenv("HOME"), "Library", "Caches")
-	case "linux", "freebsd":
-		return filepath.Join(os.Getenv("HOME"), ".cache")
+	dir, err := tokenDir(home)
+	if err != nil {
+		return "", err
 	}
-	log.Printf("TODO: osUserCacheDir on GOOS %q", runtime.GOOS)
-	return "."
+	file := filepath.Join(dir, url.QueryEscape(fn))
+	if home == "" {
+		if err := migrateToken(legacyTokenDir(), file); err != nil {
+			return "", err
+		}
+	}
+	return file, nil
+}
+
+// persistingTokenSource writes the token to the cache file whenever the
+// wrapped source returns a new one, e.g. after refreshing it.
+type persistingTokenSource struct {
+	source     oauth2.TokenSource
+	file       string
+	passphrase []byte
+
+	sync.Mutex // protects last
+	last       *oauth2.Token
+}
+
+// NewPersistingTokenSource returns a TokenSource that returns the tokens of
+// source and saves every new token to file, encrypted with the Passphrase of
+// opts. The token is the one that is already cached, if any.
+func NewPersistingTokenSource(source oauth2.TokenSource, file string, token *oauth2.Token, opts Options) oauth2.TokenSource {
+	return &persistingTokenSource{source: source, file: file, passphrase: opts.Passphrase, last: token}
 }
 
-// tokenFromFile returns the oAuth token stored in a given filename.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
 	if err != nil {
 		return nil, err
 	}
-	t := new(oauth2.Token)
-	err = gob.NewDecoder(f).Decode(t)
-	return t, err
+
+	s.Lock()
+	defer s.Unlock()
+	if s.last == nil || s.last.AccessToken != token.AccessToken || s.last.RefreshToken != token.RefreshToken {
+		if err := saveToken(s.file, token, s.passphrase); err != nil {
+			log.Printf("Warning: failed to cache oauth token: %v", err)
+		}
+		s.last = token
+	}
+	return token, nil
 }
 
-// saveToken stores an oAuth token in the given filename.
-func saveToken(file string, token *oauth2.Token) {
-	f, err := os.Create(file)
-	if err != nil {
-		log.Printf("Warning: failed to cache oauth token: %v", err)
-		return
+// DefaultAuthTimeout is how long to wait for the user to sign in, unless
+// Options say otherwise
+const DefaultAuthTimeout = 5 * time.Minute
+
+// openBrowser opens the URL in a browser, tests replace it
+var openBrowser = openUrl
+
+// randomString returns n random bytes, base64url encoded without padding
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
 	}
-	defer f.Close()
-	gob.NewEncoder(f).Encode(token)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge returns the S256 code challenge for a PKCE code verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
 }
 
-// tokenFromWeb attempts to authorize the application by directing the user to
-// Google. This spawns a web server on localhost which the user is eventually
-// redirected to.
-func tokenFromWeb(debug bool, config *oauth2.Config) *oauth2.Token {
-	ch := make(chan string)
-	randState := fmt.Sprintf("st%d", time.Now().UnixNano())
-	listener := newLocalListener(*redirectPort)
+// tokenFromWeb authorizes the application by directing the user to the
+// authorization page in a browser. This spawns a web server on localhost at
+// the port of the configured RedirectURL, which the user is eventually
+// redirected to with the authorization code. The code is bound to this
+// request by a random state and PKCE. The user has the given time to sign in.
+func tokenFromWeb(ctx context.Context, config *oauth2.Config, timeout time.Duration) (*oauth2.Token, error) {
+	if timeout <= 0 {
+		timeout = DefaultAuthTimeout
+	}
+	redirect := config.RedirectURL
+	if redirect == "" {
+		redirect = RedirectURL(DefaultRedirectHost, DefaultRedirectPort)
+	}
+	redirectURL, err := url.Parse(redirect)
+	if err != nil || redirectURL.Scheme != "http" || redirectURL.Port() == "" {
+		return nil, fmt.Errorf("Invalid redirect URL %q, expected http://host:port/", redirect)
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := newLocalListener(redirectURL.Port())
+	if err != nil {
+		return nil, err
+	}
+	listener := &historyListener{Listener: l}
+	defer listener.closeAll()
+
+	type result struct {
+		code string
+		err  error
+	}
+	ch := make(chan result, 1)
 	go http.Serve(listener, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		if req.URL.Path == "/favicon.ico" {
+		if req.URL.Path != "/" {
 			http.Error(rw, "", 404)
 			return
 		}
-		if req.FormValue("state") != randState {
-			log.Printf("State doesn't match: req = %#v", req)
-			http.Error(rw, "", 500)
+		if req.FormValue("state") != state {
+			http.Error(rw, "Invalid state, please sign in again", 400)
 			return
 		}
+
+		var res result
 		if code := req.FormValue("code"); code != "" {
 			fmt.Fprintf(rw, "<h1>Success</h1>Authorized.")
-			rw.(http.Flusher).Flush()
-			ch <- code
-			return
+			res.code = code
+		} else {
+			http.Error(rw, "Not authorized", 400)
+			res.err = fmt.Errorf("Authorization failed: %s %s", req.FormValue("error"), req.FormValue("error_description"))
+		}
+		select {
+		case ch <- res:
+		default:
+			// only the first response counts
 		}
-		log.Printf("no code")
-		http.Error(rw, "", 500)
 	}))
-	defer listener.Close()
-
-	config.RedirectURL = fmt.Sprintf("http://%s:%s/", *redirectHost, redirectPort)
-	authUrl := config.AuthCodeURL(randState)
-	go openUrl(authUrl)
 
+	// the listener is on a random port if the redirect URL asks for port 0
+	if addr, ok := l.Addr().(*net.TCPAddr); ok {
+		redirectURL.Host = net.JoinHostPort(redirectURL.Hostname(), strconv.Itoa(addr.Port))
+	}
+	webConfig := *config
+	webConfig.RedirectURL = redirectURL.String()
+	authUrl := webConfig.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	go openBrowser(authUrl)
 	log.Printf("Authorize this app at: %s", authUrl)
-	code := <-ch
-	log.Printf("Got code: %s", code)
 
-	tok, err := config.Exchange(oauth2.NoContext, code)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var res result
+	select {
+	case res = <-ch:
+	case <-timer.C:
+		return nil, fmt.Errorf("Timed out after %s waiting for authorization", timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	token, err := webConfig.Exchange(ctx, res.code, oauth2.SetAuthURLParam("code_verifier", verifier))
 	if err != nil {
-		log.Fatalf("Token exchange error: %v", err)
+		return nil, fmt.Errorf("Token exchange error: %w", err)
 	}
-	return tok
+	return token, nil
+}
+
+// tokenFromDevice authorizes the application with a device code, which the
+// user enters on another device.
+func tokenFromDevice(ctx context.Context, config *oauth2.Config, deviceAuthURL string) (*oauth2.Token, error) {
+	return DeviceToken(ctx, http.DefaultClient, config, deviceAuthURL, func(code *DeviceCode) {
+		if code.Message != "" {
+			fmt.Fprintln(os.Stderr, code.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "To sign in, open %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+		}
+	})
 }
 
 // historyListener keeps track of all connections that it's ever
@@ -161,14 +357,25 @@ func (hs *historyListener) Accept() (c net.Conn, err error) {
 	return
 }
 
-func newLocalListener(port string) net.Listener {
+// closeAll closes the listener and all connections it has accepted
+func (hs *historyListener) closeAll() {
+	hs.Listener.Close()
+	hs.Lock()
+	defer hs.Unlock()
+	for _, c := range hs.history {
+		c.Close()
+	}
+	hs.history = nil
+}
+
+func newLocalListener(port string) (net.Listener, error) {
 	l, err := net.Listen("tcp", "127.0.0.1:"+port)
 	if err != nil {
-		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
-			panic(fmt.Sprintf("httptest: failed to listen on a port: %v", err))
-		}
+		// the redirect URL is registered with the app, so another port
+		// would not be accepted
+		return nil, fmt.Errorf("Failed to listen on port %s of the redirect URL, it may be in use: %w", port, err)
 	}
-	return l
+	return l, nil
 }
 
 func openUrl(url string) {
@@ -182,16 +389,52 @@ func openUrl(url string) {
 	log.Printf("Error opening URL in browser.")
 }
 
-// New OAuthClient creates a new client against the Microsoft OAuth2 API
-func OAuthClient(appName string, debug bool, config *oauth2.Config) *http.Client {
-	cacheFile := tokenCacheFilename(appName, config)
-	token, err := tokenFromFile(cacheFile)
+// signIn asks the user to sign in, with a device code if there is a
+// DeviceAuthURL in opts and in a local browser otherwise.
+func signIn(ctx context.Context, config *oauth2.Config, opts Options) (*oauth2.Token, error) {
+	if opts.DeviceAuthURL != "" {
+		return tokenFromDevice(ctx, config, opts.DeviceAuthURL)
+	}
+	return tokenFromWeb(ctx, config, opts.AuthTimeout)
+}
+
+// New OAuthClient creates a new client against the Microsoft OAuth2 API,
+// signing in if there is no cached token. Signing in and refreshing the token
+// stop when the context is cancelled.
+func OAuthClient(ctx context.Context, appName string, config *oauth2.Config, opts Options) (*http.Client, error) {
+	cacheFile, err := tokenCacheFilename(appName, config, opts.Home)
 	if err != nil {
-		token = tokenFromWeb(debug, config)
-		saveToken(cacheFile, token)
+		return nil, err
+	}
+	token, err := tokenFromFile(cacheFile, opts.Passphrase)
+	var cached *oauth2.Token
+	if errors.Is(err, ErrTokenEncrypted) {
+		// signing in again would overwrite the cache
+		return nil, fmt.Errorf("Error reading %q: %w", cacheFile, err)
+	} else if err != nil {
+		token, err = signIn(ctx, config, opts)
 	} else {
 		log.Printf("Using cached token from %q", cacheFile)
+		cached = token
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// refreshed tokens are written back to the cache
+	source := NewPersistingTokenSource(config.TokenSource(ctx, token), cacheFile, cached, opts)
+	if _, err := source.Token(); err != nil {
+		log.Printf("Warning: failed to refresh oauth token: %v", err)
 	}
+	return oauth2.NewClient(ctx, source), nil
+}
 
-	return config.Client(oauth2.NoContext, token)
+// CachedOAuthClient creates a client with the cached token, and returns an
+// error rather than signing in if there is none.
+func CachedOAuthClient(appName string, config *oauth2.Config, opts Options) (*http.Client, error) {
+	provider, err := FileTokenProvider(appName, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(oauth2.NoContext, provider), nil
 }
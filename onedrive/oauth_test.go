@@ -0,0 +1,191 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeTokenServer issues a new access token and rotates the refresh token on
+// every refresh_token grant
+type fakeTokenServer struct {
+	refreshes int
+}
+
+func (s *fakeTokenServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.FormValue("grant_type") != "refresh_token" || req.FormValue("refresh_token") != fmt.Sprintf("refresh%d", s.refreshes) {
+		rw.WriteHeader(400)
+		fmt.Fprint(rw, `{"error":"invalid_grant"}`)
+		return
+	}
+	s.refreshes++
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"access_token":  fmt.Sprintf("access%d", s.refreshes),
+		"refresh_token": fmt.Sprintf("refresh%d", s.refreshes),
+		"token_type":    "bearer",
+		"expires_in":    3600,
+	})
+}
+
+func TestPersistingTokenSource(t *testing.T) {
+	server := httptest.NewServer(&fakeTokenServer{})
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}
+	cacheFile := filepath.Join(t.TempDir(), "token")
+	expired := &oauth2.Token{AccessToken: "access0", RefreshToken: "refresh0", Expiry: time.Now().Add(-time.Hour)}
+	if err := saveToken(cacheFile, expired, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	source := NewPersistingTokenSource(config.TokenSource(oauth2.NoContext, expired), cacheFile, expired, Options{})
+	token, err := source.Token()
+	if err != nil {
+		t.Fatalf("failed when refreshing token: %s", err)
+	}
+	if token.AccessToken != "access1" {
+		t.Errorf("expected a refreshed token, got %s", token.AccessToken)
+	}
+
+	// the refreshed and rotated tokens are written back
+	cached, err := tokenFromFile(cacheFile, nil)
+	if err != nil {
+		t.Fatalf("failed when reading cached token: %s", err)
+	}
+	if cached.AccessToken != "access1" || cached.RefreshToken != "refresh1" {
+		t.Errorf("expected the refreshed token to be cached, got %#v", cached)
+	}
+
+	// a token that is still valid is not written again
+	saveToken(cacheFile, expired, nil)
+	if _, err := source.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := tokenFromFile(cacheFile, nil); cached.AccessToken != "access0" {
+		t.Errorf("expected the cache not to be rewritten for an unchanged token")
+	}
+
+	// the rotated refresh token is used for the next refresh
+	next := &oauth2.Token{AccessToken: "stale", RefreshToken: "refresh1", Expiry: time.Now().Add(-time.Hour)}
+	source = NewPersistingTokenSource(config.TokenSource(oauth2.NoContext, next), cacheFile, next, Options{})
+	if token, err := source.Token(); err != nil || token.RefreshToken != "refresh2" {
+		t.Errorf("expected the token to be refreshed again, got %v (%v)", token, err)
+	}
+}
+
+// fakeAuthServer checks the PKCE verifier when exchanging the code
+type fakeAuthServer struct {
+	challenge string
+}
+
+func (s *fakeAuthServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.FormValue("code") != "code123" || pkceChallenge(req.FormValue("code_verifier")) != s.challenge {
+		rw.WriteHeader(400)
+		fmt.Fprint(rw, `{"error":"invalid_grant"}`)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(rw, `{"access_token":"access","refresh_token":"refresh","token_type":"bearer"}`)
+}
+
+func TestTokenFromWeb(t *testing.T) {
+	defer func(open func(string)) {
+		openBrowser = open
+	}(openBrowser)
+
+	fake := &fakeAuthServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	config := &oauth2.Config{
+		ClientID:    "client",
+		Endpoint:    oauth2.Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"},
+		RedirectURL: RedirectURL("127.0.0.1", "0"),
+	}
+
+	// the browser signs in and is redirected with the code, after a forged
+	// redirect with the wrong state has been rejected
+	var states []string
+	openBrowser = func(authURL string) {
+		parsed, _ := url.Parse(authURL)
+		query := parsed.Query()
+		states = append(states, query.Get("state"))
+		if query.Get("code_challenge_method") != "S256" {
+			t.Errorf("expected a S256 code challenge, got %q", query.Get("code_challenge_method"))
+		}
+		fake.challenge = query.Get("code_challenge")
+
+		redirect := query.Get("redirect_uri")
+		if resp, err := http.Get(redirect + "?code=forged&state=guess"); err != nil || resp.StatusCode != 400 {
+			t.Errorf("expected a wrong state to be rejected, got %v (%v)", resp, err)
+		}
+		resp, err := http.Get(redirect + "?code=code123&state=" + url.QueryEscape(query.Get("state")))
+		if err != nil || resp.StatusCode != 200 {
+			t.Errorf("expected the redirect to succeed, got %v (%v)", resp, err)
+		}
+	}
+
+	token, err := tokenFromWeb(context.Background(), config, 0)
+	if err != nil {
+		t.Fatalf("failed when signing in: %s", err)
+	}
+	if token.AccessToken != "access" {
+		t.Errorf("unexpected token %#v", token)
+	}
+
+	// the state is random for every sign in
+	if _, err := tokenFromWeb(context.Background(), config, 0); err != nil {
+		t.Fatalf("failed when signing in: %s", err)
+	}
+	if len(states) != 2 || states[0] == states[1] || len(states[0]) < 32 {
+		t.Errorf("expected two different random states, got %v", states)
+	}
+	if config.RedirectURL != RedirectURL("127.0.0.1", "0") {
+		t.Errorf("expected the configuration to be unchanged, got %q", config.RedirectURL)
+	}
+
+	// declining and never returning are errors rather than fatal
+	openBrowser = func(authURL string) {
+		parsed, _ := url.Parse(authURL)
+		query := parsed.Query()
+		http.Get(query.Get("redirect_uri") + "?error=access_denied&state=" + url.QueryEscape(query.Get("state")))
+	}
+	if _, err := tokenFromWeb(context.Background(), config, 0); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected an access_denied error, got %v", err)
+	}
+
+	openBrowser = func(string) {}
+	if _, err := tokenFromWeb(context.Background(), config, 10*time.Millisecond); err == nil {
+		t.Errorf("expected an error after the timeout")
+	}
+
+	// the redirect URL is registered, so a busy port is an error rather than
+	// a redirect to another one
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer busy.Close()
+	port := strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)
+	config.RedirectURL = RedirectURL("127.0.0.1", port)
+	openBrowser = func(string) {
+		t.Errorf("expected no sign in on a busy port")
+	}
+	if _, err := tokenFromWeb(context.Background(), config, 0); err == nil || !strings.Contains(err.Error(), "port "+port) {
+		t.Errorf("expected an error naming port %s, got %v", port, err)
+	}
+}
@@ -1,43 +1,48 @@
-package main
+package onedrive
 
 import "time"
 
 
 type AsyncOperationStatus struct {
-	Status string `json:"status"` // notStarted | inProgress | completed | updating | failed | deletePending | deleteFailed | waiting
 	Operation string `json:"operation"`
 	PercentageComplete float64 `json:"percentageComplete"`
+	Status string `json:"status"` // notStarted | inProgress | completed | updating | failed | deletePending | deleteFailed | waiting
 }
 
 type Audio struct {
-	Composers string `json:"composers"`
-	Disc float64 `json:"disc"`
-	Track float64 `json:"track"`
-	Year float64 `json:"year"`
 	Album string `json:"album"`
-	Copyright string `json:"copyright"`
-	Genre string `json:"genre"`
-	IsVariableBitrate bool `json:"isVariableBitrate"`
+	AlbumArtist string `json:"albumArtist"`
 	Artist string `json:"artist"`
 	Bitrate float64 `json:"bitrate"`
-	TrackCount float64 `json:"trackCount"`
-	AlbumArtist string `json:"albumArtist"`
+	Composers string `json:"composers"`
+	Copyright string `json:"copyright"`
+	Disc float64 `json:"disc"`
 	DiscCount float64 `json:"discCount"`
 	Duration float64 `json:"duration"`
+	Genre string `json:"genre"`
 	HasDrm bool `json:"hasDrm"`
+	IsVariableBitrate bool `json:"isVariableBitrate"`
 	Title string `json:"title"`
+	Track float64 `json:"track"`
+	TrackCount float64 `json:"trackCount"`
+	Year float64 `json:"year"`
 }
 
 type Deleted struct {
 }
 
 type Drive struct {
-	Id string `json:"id"`
 	DriveType string `json:"driveType"`
+	Id string `json:"id"`
 	Owner *IdentitySet `json:"owner"`
 	Quota *Quota `json:"quota"`
 }
 
+type FileSystemInfo struct {
+	CreatedDateTime time.Time `json:"createdDateTime"` // string timestamp
+	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"` // string timestamp
+}
+
 type File struct {
 	Hashes *Hashes `json:"hashes"`
 	MimeType string `json:"mimeType"`
@@ -49,6 +54,7 @@ type Folder struct {
 
 type Hashes struct {
 	Crc32Hash string `json:"crc32Hash"` // hex
+	QuickXorHash string `json:"quickXorHash"` // base64
 	Sha1Hash string `json:"sha1Hash"` // hex
 }
 
@@ -58,42 +64,43 @@ type Identity struct {
 }
 
 type IdentitySet struct {
-	User *Identity `json:"user"`
 	Application *Identity `json:"application"`
 	Device *Identity `json:"device"`
+	User *Identity `json:"user"`
 }
 
 type Image struct {
-	Width float64 `json:"width"`
 	Height float64 `json:"height"`
+	Width float64 `json:"width"`
 }
 
 type Item struct {
-	LastModifiedBy *IdentitySet `json:"lastModifiedBy"`
-	WebUrl string `json:"webUrl"` // url
-	Photo *Photo `json:"photo"`
-	Location *Location `json:"location"`
-	Name string `json:"name"`
-	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"` // string timestamp
-	File *File `json:"file"`
-	Video *Video `json:"video"`
+	Instancecontent_downloadUrl string `json:"@content.downloadUrl"` // url
 	Instancecontent_sourceUrl string `json:"@content.sourceUrl"` // url
+	Instancename_conflictBehavior string `json:"@name.conflictBehavior"`
+	Audio *Audio `json:"audio"`
 	CTag string `json:"cTag"` // etag
-	Size float64 `json:"size"`
+	Children []*Item `json:"children"`
+	CreatedBy *IdentitySet `json:"createdBy"`
+	CreatedDateTime time.Time `json:"createdDateTime"` // string timestamp
+	Deleted *Deleted `json:"deleted"`
+	ETag string `json:"eTag"` // etag
+	File *File `json:"file"`
+	FileSystemInfo *FileSystemInfo `json:"fileSystemInfo"`
 	Folder *Folder `json:"folder"`
+	Id string `json:"id"` // identifier
 	Image *Image `json:"image"`
-	Deleted *Deleted `json:"deleted"`
+	LastModifiedBy *IdentitySet `json:"lastModifiedBy"`
+	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"` // string timestamp
+	Location *Location `json:"location"`
+	Name string `json:"name"`
+	ParentReference *ItemReference `json:"parentReference"`
+	Photo *Photo `json:"photo"`
+	Size float64 `json:"size"`
 	SpecialFolder *SpecialFolder `json:"specialFolder"`
 	Thumbnails []*ThumbnailSet `json:"thumbnails"`
-	Id string `json:"id"` // identifier
-	ETag string `json:"eTag"` // etag
-	CreatedBy *IdentitySet `json:"createdBy"`
-	CreatedDateTime time.Time `json:"createdDateTime"` // string timestamp
-	ParentReference *ItemReference `json:"parentReference"`
-	Children []*Item `json:"children"`
-	Audio *Audio `json:"audio"`
-	Instancename_conflictBehavior string `json:"@name.conflictBehavior"`
-	Instancecontent_downloadUrl string `json:"@content.downloadUrl"` // url
+	Video *Video `json:"video"`
+	WebUrl string `json:"webUrl"` // url
 }
 
 type ItemReference struct {
@@ -107,55 +114,55 @@ type SpecialFolder struct {
 }
 
 type Location struct {
+	Altitude float64 `json:"altitude"`
 	Latitude float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
-	Altitude float64 `json:"altitude"`
 }
 
 type Permission struct {
 	Id string `json:"id"`
-	Roles []string `json:"roles"` // read|write
-	Link *SharingLink `json:"link"`
 	InheritedFrom *ItemReference `json:"inheritedFrom"`
+	Link *SharingLink `json:"link"`
+	Roles []string `json:"roles"` // read|write
 }
 
 type Photo struct {
 	CameraMake string `json:"cameraMake"`
 	CameraModel string `json:"cameraModel"`
-	FNumber float64 `json:"fNumber"`
 	ExposureDenominator float64 `json:"exposureDenominator"`
 	ExposureNumerator float64 `json:"exposureNumerator"`
+	FNumber float64 `json:"fNumber"`
 	FocalLength float64 `json:"focalLength"`
 	Iso float64 `json:"iso"`
 	TakenDateTime time.Time `json:"takenDateTime"` // timestamp
 }
 
 type Quota struct {
-	Remaining float64 `json:"remaining"`
 	Deleted float64 `json:"deleted"`
+	Remaining float64 `json:"remaining"`
 	State string `json:"state"` // normal | nearing | critical | exceeded
 	Total float64 `json:"total"`
 	Used float64 `json:"used"`
 }
 
 type SharingLink struct {
-	Type string `json:"type"` // view | edit | embed | mail
+	Application *Identity `json:"application"`
 	Token string `json:"token"`
+	Type string `json:"type"` // view | edit | embed | mail
 	WebUrl string `json:"webUrl"`
-	Application *Identity `json:"application"`
 }
 
 type Thumbnail struct {
-	Width float64 `json:"width"`
 	Height float64 `json:"height"`
 	Url string `json:"url"` // url
+	Width float64 `json:"width"`
 }
 
 type ThumbnailSet struct {
 	Id string `json:"id"`
-	Small *Thumbnail `json:"small"`
-	Medium *Thumbnail `json:"medium"`
 	Large *Thumbnail `json:"large"`
+	Medium *Thumbnail `json:"medium"`
+	Small *Thumbnail `json:"small"`
 }
 
 type UploadSession struct {
@@ -172,10 +179,10 @@ type Video struct {
 }
 
 type ViewChanges struct {
-	Instancechanges_resync string `json:"@changes.resync"`
-	Value []*Item `json:"value"`
-	Instanceodata_nextLink string `json:"@odata.nextLink"` // url
 	Instancechanges_hasMoreChanges bool `json:"@changes.hasMoreChanges"`
+	Instancechanges_resync string `json:"@changes.resync"`
 	Instancechanges_token string `json:"@changes.token"`
+	Instanceodata_nextLink string `json:"@odata.nextLink"` // url
+	Value []*Item `json:"value"`
 }
 
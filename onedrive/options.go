@@ -0,0 +1,29 @@
+package onedrive
+
+import "time"
+
+// Options configure how users sign in and where and how their tokens are
+// cached. The zero value signs in with a browser and caches tokens in plain
+// text in the user's directories.
+type Options struct {
+	// Home overrides where tokens are cached, see UserDirs
+	Home string
+
+	// Passphrase is the secret the token cache is encrypted with, read from
+	// a passphrase or a key file. Without it tokens are stored in plain text,
+	// readable only by the owner of the file, with a warning every time.
+	Passphrase []byte
+
+	// DeviceAuthURL is the device authorization endpoint. If it is set, users
+	// sign in with a device code instead of a browser.
+	DeviceAuthURL string
+
+	// AuthTimeout is how long to wait for the user to sign in with a
+	// browser, DefaultAuthTimeout if it is zero
+	AuthTimeout time.Duration
+
+	// RevokeURL is the RFC 7009 token revocation endpoint used when signing
+	// out. The Microsoft identity platform has none, so by default signing
+	// out only deletes the cached token.
+	RevokeURL string
+}
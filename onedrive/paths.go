@@ -0,0 +1,62 @@
+package onedrive
+
+import (
+	"net/url"
+	"strings"
+)
+
+// itemPath returns the escaped path of an item relative to baseURL, addressed
+// by its path from the root folder, optionally followed by an action such as
+// children or content. An empty path addresses the root folder, which is the
+// root of the drive or the app folder.
+func (api *OneDriveAPI) itemPath(path, action string) string {
+	escaped := escapePath(path)
+	if escaped == "" {
+		if action == "" {
+			return api.drive + api.root
+		}
+		return api.drive + api.root + "/" + action
+	}
+	if action == "" {
+		return api.drive + api.root + ":/" + escaped
+	}
+	return api.drive + api.root + ":/" + escaped + ":/" + action
+}
+
+// endpoint returns the absolute URL for an escaped path relative to baseURL
+// and an optional query string.
+func (api *OneDriveAPI) endpoint(path, query string) string {
+	if query == "" {
+		return api.baseURL + path
+	}
+	return api.baseURL + path + "?" + query
+}
+
+// escapePath escapes each segment of a path on the drive. Colons delimit the
+// path in path-based addressing, so unlike url.PathEscape they are escaped
+// too. Empty segments and "." are dropped.
+func escapePath(path string) string {
+	cleaned := cleanPath(path)
+	if cleaned == "" {
+		return ""
+	}
+	segments := strings.Split(cleaned, "/")
+	for idx, segment := range segments {
+		escaped := url.PathEscape(segment)
+		segments[idx] = strings.Replace(escaped, ":", "%3A", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+// cleanPath drops the empty segments and "." from a path on the drive, like
+// escapePath does, so that paths to the same item are the same string.
+func cleanPath(path string) string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,97 @@
+package onedrive
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// hostileNames are file names that are valid on OneDrive but need care when
+// they are put into a URL.
+var hostileNames = []string{
+	"plain.jpg",
+	"with space.jpg",
+	"hash#tag.jpg",
+	"100%.jpg",
+	"%20literal.jpg",
+	"question?.jpg",
+	"12:30:00.jpg",
+	"semi;colon.jpg",
+	"plus+sign.jpg",
+	"amp&ersand=1.jpg",
+	"o'brien.jpg",
+	"café.jpg",
+	"日本語.jpg",
+	"emoji 😀.jpg",
+	"ends with dot.",
+	"[brackets] {braces}.jpg",
+}
+
+func TestEscapePath(t *testing.T) {
+	type testCase struct {
+		path     string
+		expected string
+	}
+
+	testCases := []testCase{
+		testCase{"", ""},
+		testCase{"/", ""},
+		testCase{".", ""},
+		testCase{"Photos/2015", "Photos/2015"},
+		testCase{"/Photos//2015/", "Photos/2015"},
+		testCase{"a#b/c?d", "a%23b/c%3Fd"},
+		testCase{"12:30", "12%3A30"},
+		testCase{"100%", "100%25"},
+		testCase{"café", "caf%C3%A9"},
+	}
+
+	for _, test := range testCases {
+		if result := escapePath(test.path); result != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.path, test.expected, result)
+		}
+	}
+}
+
+func TestHostileNames(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	for _, name := range hostileNames {
+		folder := "Photos/" + name
+		if _, err := api.EnsureFolder(folder); err != nil {
+			t.Errorf("%q: failed when creating folder: %s", name, err)
+			continue
+		}
+
+		local := filepath.Join(t.TempDir(), "file")
+		contents := []byte("contents of " + name)
+		if err := os.WriteFile(local, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.Upload(local, folder+"/"+name); err != nil {
+			t.Errorf("%q: failed when uploading: %s", name, err)
+			continue
+		}
+
+		item, err := api.Metadata(folder + "/" + name)
+		if err != nil || item.Name != name {
+			t.Errorf("%q: metadata mismatch, got %#v (%v)", name, item, err)
+			continue
+		}
+
+		hashes, err := api.ChildHashes(folder)
+		if err != nil {
+			t.Errorf("%q: failed when listing children: %s", name, err)
+			continue
+		}
+		expected := fmt.Sprintf("%x", sha1.Sum(contents))
+		if len(hashes) != 1 || hashes[0].Name != name || hashes[0].Hash != expected {
+			t.Errorf("%q: expected child with hash %s, got %v", name, expected, hashes)
+		}
+	}
+}
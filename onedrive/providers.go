@@ -0,0 +1,148 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenProvider provides the access tokens requests are authorized with. It
+// has the method of oauth2.TokenSource, so either can be used for the other.
+type TokenProvider interface {
+	Token() (*oauth2.Token, error)
+}
+
+// NewTokenProviderAPI returns a client like NewOneDriveAPI that authorizes
+// its requests with tokens from the provider. Requests are sent with base,
+// or http.DefaultClient if it is nil, which also sends the pre-authenticated
+// upload requests. The provider is asked for a token for every request, so
+// it decides how long a token is used.
+func NewTokenProviderAPI(provider TokenProvider, base *http.Client, baseURL, drive string) *OneDriveAPI {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	// unlike oauth2.NewClient, which would keep using a token without an
+	// expiry forever
+	client := &http.Client{Transport: &oauth2.Transport{Source: provider, Base: base.Transport}}
+	api := NewOneDriveAPI(client, baseURL, drive)
+	api.uploadClient = base
+	return api
+}
+
+// FileTokenProvider returns the token cached by OAuthClient for the app,
+// refreshing it when it expires and caching the refreshed token.
+func FileTokenProvider(appName string, config *oauth2.Config, opts Options) (TokenProvider, error) {
+	cacheFile, err := tokenCacheFilename(appName, config, opts.Home)
+	if err != nil {
+		return nil, err
+	}
+	token, err := tokenFromFile(cacheFile, opts.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewPersistingTokenSource(config.TokenSource(oauth2.NoContext, token), cacheFile, token, opts), nil
+}
+
+// MemoryTokenProvider returns the token, refreshing it when it expires
+// without caching it anywhere.
+func MemoryTokenProvider(config *oauth2.Config, token *oauth2.Token) TokenProvider {
+	return config.TokenSource(oauth2.NoContext, token)
+}
+
+// StaticTokenProvider always returns the access token, which is never
+// refreshed.
+func StaticTokenProvider(accessToken string) TokenProvider {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken, TokenType: "Bearer"})
+}
+
+// envTokenProvider reads the access token from an environment variable
+type envTokenProvider string
+
+// EnvTokenProvider returns the access token in the environment variable,
+// which is read whenever a token is needed.
+func EnvTokenProvider(name string) TokenProvider {
+	return envTokenProvider(name)
+}
+
+func (name envTokenProvider) Token() (*oauth2.Token, error) {
+	token := strings.TrimSpace(os.Getenv(string(name)))
+	if token == "" {
+		return nil, fmt.Errorf("No access token in $%s", string(name))
+	}
+	return &oauth2.Token{AccessToken: token, TokenType: "Bearer"}, nil
+}
+
+// CommandTokenLifetime is how long a token printed by a command without an
+// expiry is used before running the command again
+var CommandTokenLifetime = 5 * time.Minute
+
+// commandToken is the JSON a command can print instead of a bare token
+type commandToken struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresIn   int64     `json:"expires_in"`
+	Expiry      time.Time `json:"expiry"`
+
+	// as printed by az account get-access-token
+	AzureAccessToken string `json:"accessToken"`
+	AzureExpiresOn   int64  `json:"expires_on"`
+}
+
+// commandTokenProvider runs a command for every new token
+type commandTokenProvider struct {
+	ctx  context.Context
+	name string
+	args []string
+}
+
+// CommandTokenProvider returns the access token printed by the command,
+// either by itself or as a JSON object with an access_token and optionally
+// an expires_in or expiry. The command is run again once the token expires.
+func CommandTokenProvider(ctx context.Context, name string, args ...string) TokenProvider {
+	return oauth2.ReuseTokenSource(nil, &commandTokenProvider{ctx: ctx, name: name, args: args})
+}
+
+func (p *commandTokenProvider) Token() (*oauth2.Token, error) {
+	cmd := exec.CommandContext(p.ctx, p.name, p.args...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Token command %s failed: %w", p.name, err)
+	}
+	output = bytes.TrimSpace(output)
+	now := time.Now()
+
+	if !bytes.HasPrefix(output, []byte("{")) {
+		if len(output) == 0 {
+			return nil, fmt.Errorf("Token command %s printed no token", p.name)
+		}
+		return &oauth2.Token{AccessToken: string(output), TokenType: "Bearer", Expiry: now.Add(CommandTokenLifetime)}, nil
+	}
+
+	var response commandToken
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("Could not decode the output of token command %s: %w", p.name, err)
+	}
+	token := &oauth2.Token{AccessToken: response.AccessToken, TokenType: "Bearer", Expiry: response.Expiry}
+	if token.AccessToken == "" {
+		token.AccessToken = response.AzureAccessToken
+	}
+	switch {
+	case token.AccessToken == "":
+		return nil, fmt.Errorf("Token command %s printed no access token", p.name)
+	case response.ExpiresIn > 0:
+		token.Expiry = now.Add(time.Duration(response.ExpiresIn) * time.Second)
+	case response.AzureExpiresOn > 0:
+		token.Expiry = time.Unix(response.AzureExpiresOn, 0)
+	case token.Expiry.IsZero():
+		token.Expiry = now.Add(CommandTokenLifetime)
+	}
+	return token, nil
+}
@@ -0,0 +1,128 @@
+package onedrive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenProviderAPI(t *testing.T) {
+	drive := newFakeDrive()
+	var unauthorized []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer static" && req.Method != "PUT" {
+			unauthorized = append(unauthorized, req.Method+" "+req.URL.Path)
+		}
+		drive.ServeHTTP(rw, req)
+	}))
+	defer server.Close()
+
+	api := NewTokenProviderAPI(StaticTokenProvider("static"), server.Client(), server.URL, "")
+	if _, err := api.Quota(); err != nil {
+		t.Fatal(err)
+	}
+
+	// large files are uploaded in sessions, whose upload URLs must not be
+	// sent the token
+	local := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(local, make([]byte, 3*uploadChunkSize/2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Upload(local, "large.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if len(unauthorized) > 0 {
+		t.Errorf("expected all API requests to be authorized, got %q", unauthorized)
+	}
+}
+
+func TestMemoryTokenProvider(t *testing.T) {
+	server := httptest.NewServer(&fakeTokenServer{})
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}
+	expired := &oauth2.Token{AccessToken: "access0", RefreshToken: "refresh0", Expiry: time.Now().Add(-time.Hour)}
+	token, err := MemoryTokenProvider(config, expired).Token()
+	if err != nil || token.AccessToken != "access1" {
+		t.Errorf("expected a refreshed token, got %v (%v)", token, err)
+	}
+}
+
+func TestEnvTokenProvider(t *testing.T) {
+	provider := EnvTokenProvider("CLOUD_BACKUP_TEST_TOKEN")
+	t.Setenv("CLOUD_BACKUP_TEST_TOKEN", "")
+	if _, err := provider.Token(); err == nil {
+		t.Errorf("expected an error without a token")
+	}
+	t.Setenv("CLOUD_BACKUP_TEST_TOKEN", "from-env\n")
+	if token, err := provider.Token(); err != nil || token.AccessToken != "from-env" {
+		t.Errorf("expected the token in the environment, got %v (%v)", token, err)
+	}
+
+	// a token replaced in the environment is used for the next request
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorizations = append(authorizations, req.Header.Get("Authorization"))
+		newFakeDrive().ServeHTTP(rw, req)
+	}))
+	defer server.Close()
+	api := NewTokenProviderAPI(provider, server.Client(), server.URL, "")
+	api.Quota()
+	t.Setenv("CLOUD_BACKUP_TEST_TOKEN", "renewed")
+	api.Quota()
+	if expected := []string{"Bearer from-env", "Bearer renewed"}; fmt.Sprint(authorizations) != fmt.Sprint(expected) {
+		t.Errorf("expected authorizations %q, got %q", expected, authorizations)
+	}
+}
+
+func TestCommandTokenProvider(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run token commands with")
+	}
+
+	type testCase struct {
+		script   string
+		expected string
+		expiry   time.Duration // roughly, from now
+		err      bool
+	}
+
+	testCases := []testCase{
+		testCase{"echo plain", "plain", CommandTokenLifetime, false},
+		testCase{`echo '{"access_token": "json", "expires_in": 3600}'`, "json", time.Hour, false},
+		testCase{fmt.Sprintf(`echo '{"accessToken": "az", "expires_on": %d}'`, time.Now().Add(2*time.Hour).Unix()), "az", 2 * time.Hour, false},
+		testCase{"true", "", 0, true},
+		testCase{"exit 1", "", 0, true},
+		testCase{`echo '{"expires_in": 3600}'`, "", 0, true},
+	}
+
+	for _, test := range testCases {
+		token, err := CommandTokenProvider(context.Background(), "sh", "-c", test.script).Token()
+		if test.err && err == nil {
+			t.Errorf("%s: expected an error, got %v", test.script, token)
+			continue
+		} else if test.err {
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", test.script, err)
+			continue
+		}
+		if test.expected != "" && token.AccessToken != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.script, test.expected, token.AccessToken)
+		}
+		if test.expiry != 0 && time.Until(token.Expiry).Round(time.Minute) != test.expiry {
+			t.Errorf("%s: expected expiry in %s, got %s", test.script, test.expiry, token.Expiry)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package onedrive
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+	"io"
+	"os"
+)
+
+// quickXorHash implements the QuickXorHash algorithm used by OneDrive for
+// Business, which is the only content hash available on those drives. It is
+// a port of the reference implementation published by Microsoft.
+type quickXorHash struct {
+	data        [3]uint64
+	shiftSoFar  int
+	lengthSoFar uint64
+}
+
+const (
+	quickXorWidth = 160
+	quickXorShift = 11
+	quickXorSize  = (quickXorWidth-1)/8 + 1
+)
+
+// NewQuickXorHash returns a hash.Hash computing the QuickXorHash
+func NewQuickXorHash() hash.Hash {
+	return &quickXorHash{}
+}
+
+func (q *quickXorHash) Write(p []byte) (int, error) {
+	currentShift := q.shiftSoFar
+	vectorArrayIndex := currentShift / 64
+	vectorOffset := currentShift % 64
+	iterations := len(p)
+	if iterations > quickXorWidth {
+		iterations = quickXorWidth
+	}
+
+	for i := 0; i < iterations; i++ {
+		isLastCell := vectorArrayIndex == len(q.data)-1
+		bitsInVectorCell := 64
+		if isLastCell {
+			bitsInVectorCell = quickXorWidth % 64
+		}
+
+		if vectorOffset <= bitsInVectorCell-8 {
+			for j := i; j < len(p); j += quickXorWidth {
+				q.data[vectorArrayIndex] ^= uint64(p[j]) << uint(vectorOffset)
+			}
+		} else {
+			index1 := vectorArrayIndex
+			index2 := 0
+			if !isLastCell {
+				index2 = vectorArrayIndex + 1
+			}
+			low := bitsInVectorCell - vectorOffset
+
+			var xoredByte byte
+			for j := i; j < len(p); j += quickXorWidth {
+				xoredByte ^= p[j]
+			}
+			q.data[index1] ^= uint64(xoredByte) << uint(vectorOffset)
+			q.data[index2] ^= uint64(xoredByte) >> uint(low)
+		}
+
+		vectorOffset += quickXorShift
+		for vectorOffset >= bitsInVectorCell {
+			if isLastCell {
+				vectorArrayIndex = 0
+			} else {
+				vectorArrayIndex++
+			}
+			vectorOffset -= bitsInVectorCell
+		}
+	}
+
+	q.shiftSoFar = (q.shiftSoFar + quickXorShift*(len(p)%quickXorWidth)) % quickXorWidth
+	q.lengthSoFar += uint64(len(p))
+	return len(p), nil
+}
+
+func (q *quickXorHash) Sum(b []byte) []byte {
+	var buf [24]byte
+	for i, cell := range q.data {
+		binary.LittleEndian.PutUint64(buf[i*8:], cell)
+	}
+	result := buf[:quickXorSize]
+
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], q.lengthSoFar)
+	for i := range length {
+		result[quickXorWidth/8-8+i] ^= length[i]
+	}
+	return append(b, result...)
+}
+
+func (q *quickXorHash) Reset() {
+	*q = quickXorHash{}
+}
+
+func (q *quickXorHash) Size() int {
+	return quickXorSize
+}
+
+func (q *quickXorHash) BlockSize() int {
+	return 64
+}
+
+// QuickXorHash returns the base64 encoded QuickXorHash of a local file, as
+// reported by OneDrive for Business.
+func QuickXorHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := NewQuickXorHash()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,50 @@
+package onedrive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestQuickXorHash(t *testing.T) {
+	type testCase struct {
+		input    []byte
+		expected string
+	}
+
+	testCases := []testCase{
+		testCase{[]byte{}, "AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		testCase{[]byte{0x4a}, "SgAAAAAAAAAAAAAAAQAAAAAAAAA="},
+		testCase{[]byte{0xb5, 0xb4}, "taAFAAAAAAAAAAAAAgAAAAAAAAA="},
+	}
+
+	for idx, test := range testCases {
+		hasher := NewQuickXorHash()
+		hasher.Write(test.input)
+		result := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+		if result != test.expected {
+			t.Errorf("test %d: expected %s, got %s", idx, test.expected, result)
+		}
+	}
+}
+
+func TestQuickXorHashIncremental(t *testing.T) {
+	input := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog"), 100)
+
+	whole := NewQuickXorHash()
+	whole.Write(input)
+
+	for _, chunkSize := range []int{1, 7, 160, 333} {
+		chunked := NewQuickXorHash()
+		for i := 0; i < len(input); i += chunkSize {
+			end := i + chunkSize
+			if end > len(input) {
+				end = len(input)
+			}
+			chunked.Write(input[i:end])
+		}
+		if !bytes.Equal(whole.Sum(nil), chunked.Sum(nil)) {
+			t.Errorf("hash mismatch when writing in chunks of %d bytes", chunkSize)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package onedrive
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// SearchResult is an item found by Search
+type SearchResult struct {
+	Path     string    `json:"path"` // the path from the root of the drive, or the name if unknown
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Hash     string    `json:"hash,omitempty"` // see FileHash
+	HashType HashType  `json:"hashType,omitempty"`
+	Folder   bool      `json:"folder,omitempty"`
+}
+
+func (api *OneDriveAPI) Search(folder, query string) ([]SearchResult, error) {
+	return api.SearchContext(context.Background(), folder, query)
+}
+
+// SearchContext searches the folder and all of its descendants for items
+// matching the query, which is matched against names, metadata and contents.
+// An empty folder searches the whole drive.
+func (api *OneDriveAPI) SearchContext(ctx context.Context, folder, query string) ([]SearchResult, error) {
+	var endpoint string
+	const fields = "$select=id,name,size,folder,file,fileSystemInfo,lastModifiedDateTime,parentReference"
+	if api.baseURL == OneDriveBaseURL {
+		endpoint = api.endpoint(api.itemPath(folder, "view.search"), "q="+url.QueryEscape(query)+"&"+fields)
+	} else {
+		// quotes in OData string literals are escaped by doubling them
+		literal := strings.Replace(query, "'", "''", -1)
+		endpoint = api.endpoint(api.itemPath(folder, "search(q='"+url.PathEscape(literal)+"')"), fields)
+	}
+
+	// results are reported relative to the root of the drive, so in the app
+	// folder its path has to be removed
+	appFolder := ""
+	if api.root == AppFolderRoot {
+		item, err := api.AppFolderContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		appFolder, _ = api.remotePath(item)
+	}
+
+	scope := strings.Trim(path.Clean("/"+folder), "/")
+	var results []SearchResult
+	err := api.listItems(ctx, endpoint, func(item *Item) {
+		itemPath, known := api.remotePath(item)
+		if known && appFolder != "" {
+			if !strings.HasPrefix(itemPath, appFolder+"/") {
+				return
+			}
+			itemPath = strings.TrimPrefix(itemPath, appFolder+"/")
+		}
+		// the search may return items outside of the folder on some drives
+		if known && scope != "" && !strings.HasPrefix(itemPath, scope+"/") {
+			return
+		}
+
+		result := SearchResult{
+			Path:     itemPath,
+			Size:     int64(item.Size),
+			Modified: item.LastModifiedDateTime,
+			Folder:   item.Folder != nil,
+		}
+		result.Hash, result.HashType = remoteHash(item)
+		if item.FileSystemInfo != nil {
+			result.Modified = item.FileSystemInfo.LastModifiedDateTime
+		}
+		results = append(results, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// remotePath returns the path of an item from the root of the drive, using
+// its parent reference. If the parent is not known only the name is returned.
+func (api *OneDriveAPI) remotePath(item *Item) (string, bool) {
+	if item.ParentReference == nil {
+		return item.Name, false
+	}
+	parent := item.ParentReference.Path
+	idx := strings.Index(parent, "root:")
+	if idx < 0 {
+		return item.Name, false
+	}
+	parent = parent[idx+len("root:"):]
+
+	// Microsoft Graph percent-encodes the path
+	if api.baseURL != OneDriveBaseURL {
+		if unescaped, err := url.PathUnescape(parent); err == nil {
+			parent = unescaped
+		}
+	}
+	return strings.TrimPrefix(path.Join(parent, item.Name), "/"), true
+}
@@ -0,0 +1,61 @@
+package onedrive
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	local := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(local, []byte("contents"), 0644)
+	for _, name := range []string{
+		"Backup/2015/beach.jpg",
+		"Backup/2015/Beach party.jpg",
+		"Backup/2016/beach #2.jpg",
+		"Backup/2016/o'beach.jpg",
+		"Backup/2016/mountain.jpg",
+		"Other/beach.jpg",
+	} {
+		api.EnsureFolder(filepath.Dir(name))
+		if _, err := api.Upload(local, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := api.Search("", "beach")
+	if err != nil {
+		t.Fatalf("failed when searching: %s", err)
+	}
+	// results are spread over several pages
+	if len(results) != 5 {
+		t.Errorf("expected 5 results for the whole drive, got %v", results)
+	}
+
+	results, err = api.Search("Backup", "beach")
+	if err != nil {
+		t.Fatalf("failed when searching: %s", err)
+	}
+	expected := []string{"Backup/2015/Beach party.jpg", "Backup/2015/beach.jpg", "Backup/2016/beach #2.jpg", "Backup/2016/o'beach.jpg"}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), results)
+	}
+	for idx, result := range results {
+		if result.Path != expected[idx] {
+			t.Errorf("result %d: expected %q, got %q", idx, expected[idx], result.Path)
+		}
+		if result.Size != 8 || result.Hash != "4a756ca07e9487f482465a99e8286abc86ba4dc7" || result.Modified.IsZero() {
+			t.Errorf("result %d: missing size, hash or modification time: %#v", idx, result)
+		}
+	}
+
+	if results, err := api.Search("Backup", "o'beach"); err != nil || len(results) != 1 {
+		t.Errorf("expected a single result for a quoted query, got %v (%v)", results, err)
+	}
+}
@@ -0,0 +1,85 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	ViewLink = "view" // a read-only sharing link
+	EditLink = "edit" // a read-write sharing link
+)
+
+type permissionList struct {
+	Value []*Permission `json:"value"`
+}
+
+func (api *OneDriveAPI) CreateLink(path, linkType string) (*Permission, error) {
+	return api.CreateLinkContext(context.Background(), path, linkType)
+}
+
+// CreateLinkContext creates a sharing link of the given type (ViewLink or
+// EditLink) for the item at path. If a link of that type already exists it
+// is returned instead of creating a new one.
+func (api *OneDriveAPI) CreateLinkContext(ctx context.Context, path, linkType string) (*Permission, error) {
+	if linkType != ViewLink && linkType != EditLink {
+		return nil, fmt.Errorf("Invalid link type %q, expected %s or %s", linkType, ViewLink, EditLink)
+	}
+
+	endpoint := api.endpoint(api.itemPath(path, api.action("createLink")), "")
+	body := getIndentedJSON(map[string]string{"type": linkType})
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var response Permission
+	err = api.doJSON(req, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (api *OneDriveAPI) Permissions(path string) ([]*Permission, error) {
+	return api.PermissionsContext(context.Background(), path)
+}
+
+// PermissionsContext lists the permissions of the item at path, including
+// those inherited from its ancestors, which have InheritedFrom set.
+func (api *OneDriveAPI) PermissionsContext(ctx context.Context, path string) ([]*Permission, error) {
+	endpoint := api.endpoint(api.itemPath(path, "permissions"), "")
+
+	var response permissionList
+	err := api.getJSON(ctx, endpoint, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Value, nil
+}
+
+func (api *OneDriveAPI) DeletePermission(path, id string) error {
+	return api.DeletePermissionContext(context.Background(), path, id)
+}
+
+// DeletePermissionContext revokes the permission with the given id from the
+// item at path. Inherited permissions can only be revoked on the item they
+// are inherited from.
+func (api *OneDriveAPI) DeletePermissionContext(ctx context.Context, path, id string) error {
+	endpoint := api.endpoint(api.itemPath(path, "permissions/"+url.PathEscape(id)), "")
+	req, err := http.NewRequestWithContext(ctx, "DELETE", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
@@ -0,0 +1,61 @@
+package onedrive
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSharingLinks(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	if _, err := api.EnsureFolder("Photos/Album #1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.CreateLink("Photos", "embed"); err == nil {
+		t.Errorf("expected an error for an unsupported link type")
+	}
+	if _, err := api.CreateLink("Missing", ViewLink); !errors.Is(err, PathNotFound) {
+		t.Errorf("expected PathNotFound for a missing item, got %v", err)
+	}
+
+	view, err := api.CreateLink("Photos", ViewLink)
+	if err != nil {
+		t.Fatalf("failed when creating view link: %s", err)
+	}
+	if view.Link == nil || view.Link.Type != ViewLink || view.Link.WebUrl == "" {
+		t.Errorf("expected a view link, got %#v", view)
+	}
+	edit, err := api.CreateLink("Photos/Album #1", EditLink)
+	if err != nil {
+		t.Fatalf("failed when creating edit link: %s", err)
+	}
+
+	perms, err := api.Permissions("Photos/Album #1")
+	if err != nil {
+		t.Fatalf("failed when listing permissions: %s", err)
+	}
+	if len(perms) != 2 {
+		t.Fatalf("expected 2 permissions, got %d", len(perms))
+	}
+	if perms[0].Id != edit.Id || perms[0].InheritedFrom != nil {
+		t.Errorf("expected the edit link on the album, got %#v", perms[0])
+	}
+	if perms[1].Id != view.Id || perms[1].InheritedFrom == nil || perms[1].InheritedFrom.Path != "/drive/root:/Photos" {
+		t.Errorf("expected the view link inherited from Photos, got %#v", perms[1])
+	}
+
+	if err := api.DeletePermission("Photos/Album #1", edit.Id); err != nil {
+		t.Fatalf("failed when revoking permission: %s", err)
+	}
+	if err := api.DeletePermission("Photos/Album #1", edit.Id); !errors.Is(err, PathNotFound) {
+		t.Errorf("expected PathNotFound for a revoked permission, got %v", err)
+	}
+	if perms, _ := api.Permissions("Photos/Album #1"); len(perms) != 1 {
+		t.Errorf("expected 1 permission after revoking, got %d", len(perms))
+	}
+}
@@ -0,0 +1,147 @@
+package onedrive
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SmallThumbnail  = "small"
+	MediumThumbnail = "medium"
+	LargeThumbnail  = "large"
+)
+
+type thumbnailSetList struct {
+	Value []*ThumbnailSet `json:"value"`
+}
+
+func (api *OneDriveAPI) Thumbnails(path string) ([]*ThumbnailSet, error) {
+	return api.ThumbnailsContext(context.Background(), path)
+}
+
+// ThumbnailsContext returns the thumbnail sets of the item at path. Items
+// that have no thumbnails, such as documents, return an empty list.
+func (api *OneDriveAPI) ThumbnailsContext(ctx context.Context, path string) ([]*ThumbnailSet, error) {
+	endpoint := api.endpoint(api.itemPath(path, "thumbnails"), "")
+
+	var response thumbnailSetList
+	err := api.getJSON(ctx, endpoint, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Value, nil
+}
+
+func (api *OneDriveAPI) Thumbnail(path, size string) (io.ReadCloser, error) {
+	return api.ThumbnailContext(context.Background(), path, size)
+}
+
+// ThumbnailContext returns the contents of the default thumbnail of the item
+// at path in the given size (SmallThumbnail, MediumThumbnail or
+// LargeThumbnail). The caller must close the returned reader.
+func (api *OneDriveAPI) ThumbnailContext(ctx context.Context, path, size string) (io.ReadCloser, error) {
+	if size != SmallThumbnail && size != MediumThumbnail && size != LargeThumbnail {
+		return nil, fmt.Errorf("Invalid thumbnail size %q, expected %s, %s or %s",
+			size, SmallThumbnail, MediumThumbnail, LargeThumbnail)
+	}
+
+	// like file contents, thumbnails are served from a pre-authenticated URL
+	endpoint := api.endpoint(api.itemPath(path, "thumbnails/0/"+size+"/content"), "")
+	resp, err := api.getContent(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ThumbnailCache stores thumbnails of remote items in a local folder. The
+// thumbnails themselves are stored by the hash of their contents, so items
+// with the same contents share a file, and an index maps each item and size
+// to its thumbnail. An index entry is only used while the cTag of the item,
+// which changes with its contents, is unchanged.
+type ThumbnailCache struct {
+	api *OneDriveAPI
+	dir string
+}
+
+func NewThumbnailCache(api *OneDriveAPI, dir string) *ThumbnailCache {
+	return &ThumbnailCache{api: api, dir: dir}
+}
+
+func (c *ThumbnailCache) Get(path, size string) (string, error) {
+	return c.GetContext(context.Background(), path, size)
+}
+
+// GetContext returns the local filename of the thumbnail of the item at path
+// in the given size, fetching it if it isn't cached or the item has changed.
+func (c *ThumbnailCache) GetContext(ctx context.Context, path, size string) (string, error) {
+	item, err := c.api.MetadataContext(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	index := c.indexFilename(item.Id, size)
+	if entry, err := ioutil.ReadFile(index); err == nil {
+		fields := strings.SplitN(string(entry), "\n", 2)
+		if len(fields) == 2 && fields[0] == item.CTag {
+			object := c.objectFilename(fields[1])
+			if _, err := os.Stat(object); err == nil {
+				return object, nil
+			}
+		}
+	}
+
+	reader, err := c.api.ThumbnailContext(ctx, path, size)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash, err := c.store(reader)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(index, []byte(item.CTag+"\n"+hash)); err != nil {
+		return "", err
+	}
+	return c.objectFilename(hash), nil
+}
+
+// store saves the contents of the reader under their hash and returns it
+func (c *ThumbnailCache) store(reader io.Reader) (string, error) {
+	objects := filepath.Join(c.dir, "objects")
+	if err := os.MkdirAll(objects, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(objects, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha1.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hasher), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hash := fmt.Sprintf("%x", hasher.Sum(nil))
+	return hash, os.Rename(tmp.Name(), c.objectFilename(hash))
+}
+
+func (c *ThumbnailCache) objectFilename(hash string) string {
+	return filepath.Join(c.dir, "objects", hash)
+}
+
+func (c *ThumbnailCache) indexFilename(id, size string) string {
+	return filepath.Join(c.dir, "index", fmt.Sprintf("%x-%s", sha1.Sum([]byte(id)), size))
+}
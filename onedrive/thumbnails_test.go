@@ -0,0 +1,107 @@
+package onedrive
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestThumbnailCache(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewTokenProviderAPI(StaticTokenProvider("token"), server.Client(), server.URL, "")
+	var authorized []string
+	drive.hook = func(req *http.Request) {
+		if req.Header.Get("Authorization") != "" {
+			authorized = append(authorized, req.URL.Path)
+		}
+	}
+
+	local := filepath.Join(t.TempDir(), "photo.jpg")
+	os.WriteFile(local, []byte("first"), 0644)
+	for _, name := range []string{"Photos/a.jpg", "Photos/copy of a.jpg"} {
+		api.EnsureFolder("Photos")
+		if _, err := api.Upload(local, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sets, err := api.Thumbnails("Photos/a.jpg")
+	if err != nil || len(sets) != 1 || sets[0].Small == nil {
+		t.Fatalf("expected a thumbnail set, got %v (%v)", sets, err)
+	}
+	if sets, err := api.Thumbnails("Photos"); err != nil || len(sets) != 0 {
+		t.Errorf("expected no thumbnails for a folder, got %v (%v)", sets, err)
+	}
+	if _, err := api.Thumbnail("Photos/a.jpg", "huge"); err == nil {
+		t.Errorf("expected an error for an unknown thumbnail size")
+	}
+
+	cache := NewThumbnailCache(api, t.TempDir())
+	small, err := cache.Get("Photos/a.jpg", SmallThumbnail)
+	if err != nil {
+		t.Fatalf("failed when fetching thumbnail: %s", err)
+	}
+	contents, _ := ioutil.ReadFile(small)
+	if string(contents) != "small thumbnail of E0996A37C13D44C3B06074939D43FA3759BD32C1" {
+		t.Errorf("unexpected thumbnail contents %q", contents)
+	}
+
+	// the API redirects to the thumbnail, which must not be sent the token
+	fetched := 0
+	for idx, request := range drive.requests {
+		if strings.HasPrefix(request, "/thumbnail/") {
+			fetched++
+			if !strings.HasSuffix(drive.requests[idx-1], ":/thumbnails/0/small/content") {
+				t.Errorf("expected the thumbnail to be fetched after a redirect, got %q", drive.requests[:idx+1])
+			}
+		}
+	}
+	for _, request := range authorized {
+		if strings.HasPrefix(request, "/thumbnail/") {
+			t.Errorf("expected no token to be sent to the thumbnail URL, got one for %s", request)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("expected the thumbnail to be fetched once, got %d", fetched)
+	}
+
+	// cached thumbnails are not fetched again
+	requests := len(drive.requests)
+	if again, err := cache.Get("Photos/a.jpg", SmallThumbnail); err != nil || again != small {
+		t.Errorf("expected the cached thumbnail %s, got %s (%v)", small, again, err)
+	}
+	for _, request := range drive.requests[requests:] {
+		if filepath.Base(request) == "content" {
+			t.Errorf("expected the thumbnail to be served from the cache, got request %s", request)
+		}
+	}
+
+	// identical contents share a thumbnail
+	if copied, err := cache.Get("Photos/copy of a.jpg", SmallThumbnail); err != nil || copied != small {
+		t.Errorf("expected the same thumbnail for identical files, got %s (%v)", copied, err)
+	}
+	if medium, err := cache.Get("Photos/a.jpg", MediumThumbnail); err != nil || medium == small {
+		t.Errorf("expected a separate medium thumbnail, got %s (%v)", medium, err)
+	}
+
+	// new contents change the cTag, which invalidates the cached thumbnail
+	os.WriteFile(local, []byte("second"), 0644)
+	if _, err := api.Upload(local, "Photos/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := cache.Get("Photos/a.jpg", SmallThumbnail)
+	if err != nil || updated == small {
+		t.Errorf("expected a new thumbnail after the file changed, got %s (%v)", updated, err)
+	}
+
+	if _, err := cache.Get("Photos/missing.jpg", SmallThumbnail); !errors.Is(err, PathNotFound) {
+		t.Errorf("expected PathNotFound for a missing item, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package onedrive
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+)
+
+// ErrTokenEncrypted is returned when reading an encrypted token cache
+// without the right passphrase.
+var ErrTokenEncrypted = errors.New("Token cache is encrypted, a passphrase or key file is needed")
+
+// encrypted token caches start with tokenMagic, followed by the salt, the
+// nonce and the AES-GCM sealed gob encoded token
+var tokenMagic = []byte("cloud-backup token v1\n")
+
+const tokenSaltSize = 16
+
+// the scrypt cost parameters, the defaults recommended for interactive use
+var tokenScryptN, tokenScryptR, tokenScryptP = 32768, 8, 1
+
+// tokenAEAD derives the key for the given salt from the passphrase
+func tokenAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, tokenScryptN, tokenScryptR, tokenScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cachedToken is the gob encoded form of a token. Its fields have the same
+// names as those of oauth2.Token, so caches written before the granted scope
+// was stored still decode.
+type cachedToken struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time
+	Scope        string
+}
+
+// encodeToken returns the token cache contents for the token, encrypted if
+// there is a passphrase.
+func encodeToken(token *oauth2.Token, passphrase []byte) ([]byte, error) {
+	cached := cachedToken{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	cached.Scope, _ = token.Extra("scope").(string)
+
+	var plain bytes.Buffer
+	if err := gob.NewEncoder(&plain).Encode(&cached); err != nil {
+		return nil, err
+	}
+	if passphrase == nil {
+		return plain.Bytes(), nil
+	}
+
+	salt := make([]byte, tokenSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := tokenAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(append(append([]byte{}, tokenMagic...), salt...), nonce...)
+	return aead.Seal(out, nonce, plain.Bytes(), tokenMagic), nil
+}
+
+// decodeToken decodes token cache contents, and reports whether they were
+// encrypted.
+func decodeToken(contents, passphrase []byte) (*oauth2.Token, bool, error) {
+	encrypted := bytes.HasPrefix(contents, tokenMagic)
+	if encrypted {
+		if passphrase == nil {
+			return nil, true, ErrTokenEncrypted
+		}
+		rest := contents[len(tokenMagic):]
+		if len(rest) < tokenSaltSize {
+			return nil, true, fmt.Errorf("Token cache is truncated")
+		}
+		aead, err := tokenAEAD(passphrase, rest[:tokenSaltSize])
+		if err != nil {
+			return nil, true, err
+		}
+		rest = rest[tokenSaltSize:]
+		if len(rest) < aead.NonceSize() {
+			return nil, true, fmt.Errorf("Token cache is truncated")
+		}
+		plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], tokenMagic)
+		if err != nil {
+			// a wrong passphrase fails authentication
+			return nil, true, ErrTokenEncrypted
+		}
+		contents = plain
+	}
+
+	var cached cachedToken
+	if err := gob.NewDecoder(bytes.NewReader(contents)).Decode(&cached); err != nil {
+		return nil, encrypted, err
+	}
+	t := &oauth2.Token{
+		AccessToken:  cached.AccessToken,
+		TokenType:    cached.TokenType,
+		RefreshToken: cached.RefreshToken,
+		Expiry:       cached.Expiry,
+	}
+	if cached.Scope != "" {
+		t = t.WithExtra(map[string]interface{}{"scope": cached.Scope})
+	}
+	return t, encrypted, nil
+}
+
+// tokenFromFile returns the oAuth token stored in a given filename. A cache
+// that others can read, as written by older versions, is restricted to its
+// owner, and a plain text token is encrypted in place once there is a
+// passphrase.
+func tokenFromFile(file string, passphrase []byte) (*oauth2.Token, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if stat, err := os.Stat(file); err == nil && stat.Mode().Perm() != 0600 {
+		if err := os.Chmod(file, 0600); err != nil {
+			log.Printf("Warning: failed to restrict permissions of cached oauth token: %v", err)
+		}
+	}
+	t, encrypted, err := decodeToken(contents, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if !encrypted && passphrase != nil {
+		if err := saveToken(file, t, passphrase); err != nil {
+			log.Printf("Warning: failed to encrypt cached oauth token: %v", err)
+		} else {
+			log.Printf("Encrypted cached oauth token in %q", file)
+		}
+	} else if !encrypted {
+		warnPlainToken(file)
+	}
+	return t, nil
+}
+
+// saveToken stores an oAuth token in the given filename, readable only by
+// its owner, replacing the previous token atomically so an interrupted write
+// can't corrupt it. The token is encrypted if there is a passphrase.
+func saveToken(file string, token *oauth2.Token, passphrase []byte) error {
+	contents, err := encodeToken(token, passphrase)
+	if err != nil {
+		return err
+	}
+	if passphrase == nil {
+		warnPlainToken(file)
+	}
+	return writeFileAtomic(file, contents)
+}
+
+// warnPlainToken warns that the refresh token in the cache is not encrypted,
+// so anyone who can read the file can act as the signed in user.
+func warnPlainToken(file string) {
+	log.Printf("Warning: the oauth token in %q is not encrypted, anyone who can read it has access to the account. "+
+		"Set a passphrase or key file to encrypt it.", file)
+}
@@ -0,0 +1,70 @@
+package onedrive
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenCache(t *testing.T) {
+	defer func(n int) { tokenScryptN = n }(tokenScryptN)
+	tokenScryptN = 1024 // keep the test fast
+	passphrase := []byte("correct horse battery staple")
+
+	token := &oauth2.Token{AccessToken: "access-secret", RefreshToken: "refresh-secret"}
+	file := filepath.Join(t.TempDir(), "token")
+
+	// without a passphrase the token is stored in plain text for the owner
+	if err := saveToken(file, token, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stat, _ := os.Stat(file); stat.Mode().Perm() != 0600 {
+		t.Errorf("expected permissions 0600, got %o", stat.Mode().Perm())
+	}
+
+	// a cache written by an older version is restricted to its owner when read
+	os.Chmod(file, 0644)
+	if _, err := tokenFromFile(file, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stat, _ := os.Stat(file); stat.Mode().Perm() != 0600 {
+		t.Errorf("expected permissions 0600 after reading, got %o", stat.Mode().Perm())
+	}
+
+	// a plain cache is encrypted in place once there is a passphrase
+	os.Chmod(file, 0644)
+	cached, err := tokenFromFile(file, passphrase)
+	if err != nil || cached.RefreshToken != "refresh-secret" {
+		t.Fatalf("failed when reading plain token: %v (%v)", cached, err)
+	}
+	contents, _ := ioutil.ReadFile(file)
+	if !bytes.HasPrefix(contents, tokenMagic) || bytes.Contains(contents, []byte("refresh-secret")) {
+		t.Errorf("expected the plain token to be migrated to an encrypted one")
+	}
+	if stat, _ := os.Stat(file); stat.Mode().Perm() != 0600 {
+		t.Errorf("expected permissions 0600, got %o", stat.Mode().Perm())
+	}
+
+	cached, err = tokenFromFile(file, passphrase)
+	if err != nil || cached.AccessToken != "access-secret" || cached.RefreshToken != "refresh-secret" {
+		t.Errorf("failed when reading encrypted token: %v (%v)", cached, err)
+	}
+
+	// every save uses a new salt and nonce
+	saveToken(file, token, passphrase)
+	if again, _ := ioutil.ReadFile(file); bytes.Equal(again, contents) {
+		t.Errorf("expected a different ciphertext for every save")
+	}
+
+	if _, err := tokenFromFile(file, []byte("wrong")); !errors.Is(err, ErrTokenEncrypted) {
+		t.Errorf("expected ErrTokenEncrypted for a wrong passphrase, got %v", err)
+	}
+	if _, err := tokenFromFile(file, nil); !errors.Is(err, ErrTokenEncrypted) {
+		t.Errorf("expected ErrTokenEncrypted without a passphrase, got %v", err)
+	}
+}
@@ -9,12 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 )
 
 var (
 	outFilename = flag.String("o", "onedrive_types.go", "The output filename")
-	outPackage  = flag.String("p", "main", "The output package name")
+	outPackage  = flag.String("p", "onedrive", "The output package name")
 	resourceDir = flag.String("i", "resources", "The resources directory")
 )
 
@@ -33,7 +34,7 @@ func main() {
 		log.Fatalf("Failed to fetch resources: %s", err)
 	}
 
-	fmt.Fprintln(outFile, "package main\n\nimport \"time\"\n\n")
+	fmt.Fprintf(outFile, "package %s\n\nimport \"time\"\n\n\n", *outPackage)
 
 	for _, filename := range resources {
 		contents, err := ioutil.ReadFile(filename)
@@ -57,7 +58,14 @@ func main() {
 
 		// strip oneDrive. prefix off"
 		fmt.Fprintf(outFile, "type %s struct {\n", strings.Title(string(typeName)))
-		for key, typeValue := range jsonMap {
+		// sorted, so the output only changes when the resources do
+		var keys []string
+		for key := range jsonMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			typeValue := jsonMap[key]
 			typeName, ok, comment := discoverType(typeValue)
 			if !ok {
 				log.Printf("Skipping unknown type %s: %T", key, typeValue)
@@ -90,6 +98,8 @@ func discoverType(elem interface{}) (string, bool, string) {
 			return "string", true, "path"
 		} else if elem == "string (hex)" {
 			return "string", true, "hex"
+		} else if elem == "string (base64)" {
+			return "string", true, "base64"
 		} else if elem == "url" {
 			return "string", true, "url"
 		} else if elem == "timestamp" {
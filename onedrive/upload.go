@@ -0,0 +1,311 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// simpleUploadLimit is the largest file that is sent in a single request,
+	// anything larger is sent in chunks using an upload session.
+	simpleUploadLimit int64 = 4 * 1024 * 1024
+
+	// uploadChunkSize is the size of each chunk in an upload session, which
+	// must be a multiple of 320 KiB.
+	uploadChunkSize int64 = 32 * 320 * 1024
+)
+
+// localFileSystemInfo returns the timestamps of a local file to be recorded
+// on the remote copy. If the system does not know when the file was created
+// the modification time is used instead.
+func localFileSystemInfo(stat os.FileInfo) *FileSystemInfo {
+	modified := stat.ModTime().UTC()
+	created, ok := fileCreationTime(stat)
+	if !ok || created.IsZero() || created.After(modified) {
+		created = modified
+	}
+	return &FileSystemInfo{
+		CreatedDateTime:      created.UTC(),
+		LastModifiedDateTime: modified,
+	}
+}
+
+// setFileSystemInfo updates the timestamps of the remote item at path, as
+// long as it has not changed since it was observed with the given eTag.
+func (api *OneDriveAPI) setFileSystemInfo(ctx context.Context, path, eTag string, info *FileSystemInfo) (*Item, error) {
+	body := getIndentedJSON(map[string]*FileSystemInfo{"fileSystemInfo": info})
+	endpoint := api.endpoint(api.itemPath(path, ""), "")
+	req, err := http.NewRequestWithContext(ctx, "PATCH", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if eTag != "" {
+		req.Header.Set("If-Match", eTag)
+	}
+
+	var response Item
+	err = api.doJSON(req, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (api *OneDriveAPI) CreateUploadSession(remotePath string, info *FileSystemInfo, eTag string, failIfExists bool) (*UploadSession, error) {
+	return api.CreateUploadSessionContext(context.Background(), remotePath, info, eTag, failIfExists)
+}
+
+// CreateUploadSessionContext starts an upload session for a file at
+// remotePath, which will be created with the given timestamps. The eTag and
+// failIfExists have the same meaning as for UploadIfMatchContext.
+func (api *OneDriveAPI) CreateUploadSessionContext(ctx context.Context, remotePath string, info *FileSystemInfo, eTag string, failIfExists bool) (*UploadSession, error) {
+	item := map[string]interface{}{}
+	if info != nil {
+		item["fileSystemInfo"] = info
+	}
+	if failIfExists {
+		item[api.conflictBehavior()] = "fail"
+	} else {
+		item[api.conflictBehavior()] = "replace"
+	}
+	body := getIndentedJSON(map[string]interface{}{"item": item})
+
+	endpoint := api.endpoint(api.itemPath(remotePath, "createUploadSession"), "")
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if eTag != "" {
+		req.Header.Set("If-Match", eTag)
+	}
+
+	var response UploadSession
+	err = api.doJSON(req, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SetUploadStateDir keeps the upload sessions of large files in dir while
+// they are in progress. An upload interrupted by its context is then resumed
+// where the service left off by the next upload of the same, unchanged file,
+// instead of starting over. Without it, interrupted sessions are left for the
+// service to expire.
+func (api *OneDriveAPI) SetUploadStateDir(dir string) {
+	api.uploadState = dir
+}
+
+// uploadState is an upload session in progress, along with the local file it
+// uploads, which must not have changed when it is resumed.
+type uploadState struct {
+	UploadURL  string    `json:"upload_url"`
+	RemotePath string    `json:"remote_path"`
+	LocalPath  string    `json:"local_path"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+}
+
+// uploadStateFile returns the file the upload session for remotePath is kept
+// in, which depends on the drive and root as well.
+func (api *OneDriveAPI) uploadStateFile(remotePath string) string {
+	hash := fnv.New64a()
+	for _, part := range []string{api.baseURL, api.drive, api.root, remotePath} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return filepath.Join(api.uploadState, fmt.Sprintf("%016x.json", hash.Sum64()))
+}
+
+// resumeUploadSession fills in the upload URL of a session for the same file
+// that was interrupted, and returns the offset to continue from. Sessions for
+// files that have changed since, or that the service no longer knows, are
+// forgotten, leaving the upload URL empty.
+func (api *OneDriveAPI) resumeUploadSession(ctx context.Context, state *uploadState) (int64, error) {
+	if api.uploadState == "" {
+		return 0, nil
+	}
+	file := api.uploadStateFile(state.RemotePath)
+	contents, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	var saved uploadState
+	if err != nil || json.Unmarshal(contents, &saved) != nil {
+		os.Remove(file)
+		return 0, nil
+	}
+	if saved.RemotePath != state.RemotePath || saved.LocalPath != state.LocalPath ||
+		saved.Size != state.Size || !saved.Modified.Equal(state.Modified) {
+		api.cancelUploadSession(saved.UploadURL)
+		os.Remove(file)
+		return 0, nil
+	}
+
+	// the upload URL is pre-authenticated like the chunks sent to it
+	req, err := http.NewRequestWithContext(ctx, "GET", saved.UploadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	var session UploadSession
+	resp, err := api.uploadClient.Do(req)
+	if err == nil {
+		err = checkResponse(resp)
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&session)
+		}
+		resp.Body.Close()
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	} else if err != nil {
+		if !errors.Is(err, PathNotFound) {
+			log.Printf("Warning: failed to resume the upload of %s, starting over: %s", state.RemotePath, err)
+		}
+		os.Remove(file)
+		return 0, nil
+	}
+
+	// the service expects the missing ranges, of which only the first is
+	// relevant as chunks are sent in order
+	if len(session.NextExpectedRanges) == 0 {
+		os.Remove(file)
+		return 0, nil
+	}
+	start := strings.SplitN(session.NextExpectedRanges[0], "-", 2)[0]
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || offset < 0 || offset >= state.Size {
+		os.Remove(file)
+		return 0, nil
+	}
+	state.UploadURL = saved.UploadURL
+	log.Printf("Resuming the upload of %s at %d of %d bytes", state.RemotePath, offset, state.Size)
+	return offset, nil
+}
+
+// saveUploadState keeps the upload session, if there is a folder for it
+func (api *OneDriveAPI) saveUploadState(state *uploadState) {
+	if api.uploadState == "" {
+		return
+	}
+	err := os.MkdirAll(api.uploadState, 0700)
+	if err == nil {
+		err = writeFileAtomic(api.uploadStateFile(state.RemotePath), getIndentedJSON(state))
+	}
+	if err != nil {
+		log.Printf("Warning: failed to save the upload session of %s, it can't be resumed: %s", state.RemotePath, err)
+	}
+}
+
+// removeUploadState forgets the upload session once it is over
+func (api *OneDriveAPI) removeUploadState(state *uploadState) {
+	if api.uploadState != "" {
+		os.Remove(api.uploadStateFile(state.RemotePath))
+	}
+}
+
+// uploadSession uploads the local file from the reader in chunks, resuming
+// an interrupted session for it if there is one. An upload that fails is
+// cancelled, but one that is interrupted by the context is kept so that it
+// can be resumed, see SetUploadStateDir.
+func (api *OneDriveAPI) uploadSession(ctx context.Context, reader io.ReadSeeker, filename string, stat os.FileInfo, remotePath string, info *FileSystemInfo, eTag string, failIfExists bool) (*Item, error) {
+	size := stat.Size()
+	state := &uploadState{RemotePath: remotePath, LocalPath: filename, Size: size, Modified: stat.ModTime()}
+	offset, err := api.resumeUploadSession(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if state.UploadURL == "" {
+		session, err := api.CreateUploadSessionContext(ctx, remotePath, info, eTag, failIfExists)
+		if err != nil {
+			return nil, err
+		}
+		state.UploadURL = session.UploadUrl
+		api.saveUploadState(state)
+	}
+	if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	for ; offset < size; offset += uploadChunkSize {
+		length := uploadChunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		item, err := api.uploadChunk(ctx, state.UploadURL, io.LimitReader(reader, length), offset, length, size)
+		if err != nil {
+			if ctx.Err() == nil {
+				api.cancelUploadSession(state.UploadURL)
+				api.removeUploadState(state)
+			}
+			return nil, err
+		}
+		if item != nil {
+			api.removeUploadState(state)
+			return item, nil
+		}
+	}
+	api.removeUploadState(state)
+	return nil, fmt.Errorf("Upload session for %s did not complete", remotePath)
+}
+
+// uploadChunk sends one chunk of an upload session, returning the item once
+// the final chunk has been accepted. The upload URL is pre-authenticated, so
+// it must not be sent with the client's credentials.
+func (api *OneDriveAPI) uploadChunk(ctx context.Context, uploadURL string, chunk io.Reader, offset, length, size int64) (*Item, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, chunk)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+
+	resp, err := api.uploadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		// more chunks are expected
+		return nil, nil
+	}
+
+	var response Item
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (api *OneDriveAPI) cancelUploadSession(uploadURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "DELETE", uploadURL, nil)
+	if err != nil {
+		return
+	}
+	resp, err := api.uploadClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
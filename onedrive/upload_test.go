@@ -0,0 +1,193 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, contents []byte, modified time.Time) string {
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filename, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filename, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestUploadFileSystemInfo(t *testing.T) {
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	modified := time.Date(2010, 7, 4, 12, 30, 0, 0, time.UTC)
+	local := writeFile(t, []byte("contents"), modified)
+
+	item, err := api.Upload(local, "photo.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if item.FileSystemInfo == nil || !item.FileSystemInfo.LastModifiedDateTime.Equal(modified) {
+		t.Errorf("expected modification time %s, got %#v", modified, item.FileSystemInfo)
+	}
+	if item.FileSystemInfo.CreatedDateTime.After(modified) {
+		t.Errorf("expected creation time before %s, got %s", modified, item.FileSystemInfo.CreatedDateTime)
+	}
+}
+
+func TestUploadSession(t *testing.T) {
+	defer func(limit, chunk int64) {
+		simpleUploadLimit, uploadChunkSize = limit, chunk
+	}(simpleUploadLimit, uploadChunkSize)
+	simpleUploadLimit, uploadChunkSize = 10, 7
+
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+
+	modified := time.Date(2012, 1, 2, 3, 4, 5, 0, time.UTC)
+	contents := bytes.Repeat([]byte("0123456789"), 3)
+	local := writeFile(t, contents, modified)
+
+	item, err := api.UploadIfMatch(local, "video.mp4", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := fmt.Sprintf("%x", sha1.Sum(contents))
+	if hash, _ := remoteHash(item); hash != expected {
+		t.Errorf("expected hash %s, got %s", expected, hash)
+	}
+	if item.FileSystemInfo == nil || !item.FileSystemInfo.LastModifiedDateTime.Equal(modified) {
+		t.Errorf("expected modification time %s, got %#v", modified, item.FileSystemInfo)
+	}
+
+	chunks := 0
+	for _, request := range drive.requests {
+		if strings.HasPrefix(request, "/upload/") {
+			chunks++
+		}
+	}
+	if chunks != 5 {
+		t.Errorf("expected 5 chunks, got %d", chunks)
+	}
+
+	// the same preconditions apply to upload sessions
+	if _, err := api.UploadIfMatch(local, "video.mp4", ""); !errors.Is(err, Conflict) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if _, err := api.UploadIfMatch(local, "video.mp4", "stale"); !errors.Is(err, PreconditionFailed) {
+		t.Errorf("expected a failed precondition, got %v", err)
+	}
+	if _, err := api.UploadIfMatch(local, "video.mp4", item.ETag); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestUploadSessionResume(t *testing.T) {
+	defer func(limit, chunk int64) {
+		simpleUploadLimit, uploadChunkSize = limit, chunk
+	}(simpleUploadLimit, uploadChunkSize)
+	simpleUploadLimit, uploadChunkSize = 10, 7
+
+	drive := newFakeDrive()
+	server := httptest.NewServer(drive)
+	defer server.Close()
+	api := NewOneDriveAPI(server.Client(), server.URL, "")
+	stateDir := t.TempDir()
+	api.SetUploadStateDir(stateDir)
+
+	contents := bytes.Repeat([]byte("0123456789"), 3)
+	local := writeFile(t, contents, time.Date(2012, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	// the upload is interrupted while the third chunk is sent
+	var ranges []string
+	var cancel context.CancelFunc
+	drive.hook = func(req *http.Request) {
+		if req.Method == "PUT" && strings.HasPrefix(req.URL.Path, "/upload/") {
+			ranges = append(ranges, req.Header.Get("Content-Range"))
+			if len(ranges) == 3 && cancel != nil {
+				cancel()
+			}
+		}
+	}
+	interrupt := func(remotePath string) {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		ranges = nil
+		if _, err := api.UploadIfMatchContext(ctx, local, remotePath, ""); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the upload to be interrupted, got %v", err)
+		}
+		cancel = nil
+		if states, _ := ioutil.ReadDir(stateDir); len(states) != 1 {
+			t.Fatalf("expected the upload session to be kept, got %d", len(states))
+		}
+	}
+	sessions := func() int {
+		count := 0
+		for _, request := range drive.requests {
+			if strings.HasSuffix(request, ":/createUploadSession") {
+				count++
+			}
+		}
+		return count
+	}
+	check := func(item *Item, err error) {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if hash, _ := remoteHash(item); hash != fmt.Sprintf("%x", sha1.Sum(contents)) {
+			t.Errorf("expected hash %x, got %s", sha1.Sum(contents), hash)
+		}
+		if states, _ := ioutil.ReadDir(stateDir); len(states) != 0 {
+			t.Errorf("expected the upload session to be forgotten, got %d", len(states))
+		}
+	}
+
+	// the next upload continues where the service left off
+	interrupt("video.mp4")
+	ranges = nil
+	item, err := api.UploadIfMatch(local, "video.mp4", "")
+	check(item, err)
+	if sessions() != 1 || len(ranges) == 0 || strings.HasPrefix(ranges[0], "bytes 0-") {
+		t.Errorf("expected the session to be resumed, got %d sessions and ranges %q", sessions(), ranges)
+	}
+
+	// a session the service has expired is started over
+	interrupt("other.mp4")
+	drive.Lock()
+	for id := range drive.sessions {
+		delete(drive.sessions, id)
+	}
+	drive.Unlock()
+	ranges = nil
+	item, err = api.UploadIfMatch(local, "other.mp4", "")
+	check(item, err)
+	if sessions() != 3 || len(ranges) == 0 || !strings.HasPrefix(ranges[0], "bytes 0-") {
+		t.Errorf("expected a new session, got %d sessions and ranges %q", sessions(), ranges)
+	}
+
+	// as is one for a file that has changed since
+	interrupt("changed.mp4")
+	os.Chtimes(local, time.Now(), time.Now())
+	ranges = nil
+	item, err = api.UploadIfMatch(local, "changed.mp4", "")
+	check(item, err)
+	if sessions() != 5 || len(ranges) == 0 || !strings.HasPrefix(ranges[0], "bytes 0-") {
+		t.Errorf("expected a new session, got %d sessions and ranges %q", sessions(), ranges)
+	}
+}
@@ -0,0 +1,228 @@
+package main_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jnwhiteh/cloud-backup"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+// fakeRemote is a personal drive with the files of a single backup folder
+type fakeRemote struct {
+	sync.Mutex
+	files    map[string][]byte // the contents of the files in the folder
+	quickXor bool              // only provide a QuickXorHash, like newer files
+}
+
+func (f *fakeRemote) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	reply := func(status int, v interface{}) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(status)
+		json.NewEncoder(rw).Encode(v)
+	}
+	item := func(name string) *onedrive.Item {
+		contents := f.files[name]
+		hashes := &onedrive.Hashes{Sha1Hash: fmt.Sprintf("%X", sha1.Sum(contents))}
+		if f.quickXor {
+			hasher := onedrive.NewQuickXorHash()
+			hasher.Write(contents)
+			hashes = &onedrive.Hashes{QuickXorHash: base64.StdEncoding.EncodeToString(hasher.Sum(nil))}
+		}
+		return &onedrive.Item{
+			Name: name,
+			ETag: fmt.Sprintf("%x", sha1.Sum(contents)),
+			Size: float64(len(contents)),
+			File: &onedrive.File{Hashes: hashes},
+		}
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, "/drive/root:/backup/")
+	switch {
+	case req.URL.Path == "/drive":
+		reply(200, &onedrive.Drive{Id: "drive", DriveType: "personal"})
+	case req.URL.Path == "/drive/root" || req.URL.Path == "/drive/root:/backup":
+		reply(200, &onedrive.Item{Name: "backup", Folder: &onedrive.Folder{}})
+	case req.URL.Path == "/drive/root:/backup:/children":
+		list := &onedrive.ViewChanges{Value: []*onedrive.Item{}}
+		for name := range f.files {
+			list.Value = append(list.Value, item(name))
+		}
+		reply(200, list)
+	case req.Method == "PUT" && strings.HasSuffix(name, ":/content"):
+		name = strings.TrimSuffix(name, ":/content")
+		if _, exists := f.files[name]; exists && req.FormValue("@microsoft.graph.conflictBehavior") == "fail" {
+			reply(409, map[string]*onedrive.Error{"error": &onedrive.Error{Code: "nameAlreadyExists"}})
+			return
+		} else if eTag := req.Header.Get("If-Match"); eTag != "" && (!exists || eTag != item(name).ETag) {
+			reply(412, map[string]*onedrive.Error{"error": &onedrive.Error{Code: "preconditionFailed"}})
+			return
+		}
+		f.files[name], _ = ioutil.ReadAll(req.Body)
+		reply(201, item(name))
+	case req.Method == "GET" && f.files[strings.TrimSuffix(name, ":/content")] != nil:
+		rw.Write(f.files[strings.TrimSuffix(name, ":/content")])
+	case req.Method == "PATCH" && f.files[name] != nil:
+		reply(200, item(name))
+	default:
+		// including $batch, so requests are sent one at a time
+		reply(404, map[string]*onedrive.Error{"error": &onedrive.Error{Code: "itemNotFound"}})
+	}
+}
+
+func TestUploadConflict(t *testing.T) {
+	remote := &fakeRemote{files: map[string][]byte{"a": []byte("a")}}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	api := onedrive.NewOneDriveAPI(server.Client(), server.URL, "")
+	fs, err := main.NewOneDriveFilesystem(context.Background(), api)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+	local := fs.LocalFilesystem()
+
+	syncer := main.NewSyncer(&local, fs)
+	files, err := syncer.SyncStatus(dir, "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// another machine backs up c after it was planned, which must not be
+	// overwritten
+	remote.Lock()
+	remote.files["c"] = []byte("other")
+	remote.Unlock()
+	if err := syncer.Upload(files, "backup", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []main.Status{main.STATUS_ALREADY, main.STATUS_UPLOADED, main.STATUS_CONFLICT}
+	for idx, file := range files {
+		if file.Status != expected[idx] || file.Error != nil {
+			t.Errorf("%s: expected status %q, got %q (%v)", file.Filename, expected[idx], file.Status, file.Error)
+		}
+	}
+	if string(remote.files["b"]) != "b" || string(remote.files["c"]) != "other" {
+		t.Errorf("expected only b to be uploaded, got %q", remote.files)
+	}
+}
+
+func TestUploadOverwrite(t *testing.T) {
+	remote := &fakeRemote{files: map[string][]byte{"a": []byte("old"), "b": []byte("old")}}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	api := onedrive.NewOneDriveAPI(server.Client(), server.URL, "")
+	fs, err := main.NewOneDriveFilesystem(context.Background(), api)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+	local := fs.LocalFilesystem()
+
+	syncer := main.NewSyncer(&local, fs)
+	if _, err := syncer.SyncStatus(dir, "backup"); err != main.ERR_REMOTE_NOT_CLEAN {
+		t.Fatalf("expected %v without overwriting, got %v", main.ERR_REMOTE_NOT_CLEAN, err)
+	}
+	syncer.Overwrite = true
+	files, err := syncer.SyncStatus(dir, "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// b is changed remotely after it was planned, so only the version that
+	// was listed may be replaced
+	remote.Lock()
+	remote.files["b"] = []byte("other")
+	remote.Unlock()
+	if err := syncer.Upload(files, "backup", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []main.Status{main.STATUS_UPLOADED, main.STATUS_CONFLICT}
+	for idx, file := range files {
+		if file.Status != expected[idx] || file.Error != nil {
+			t.Errorf("%s: expected status %q, got %q (%v)", file.Filename, expected[idx], file.Status, file.Error)
+		}
+	}
+	if string(remote.files["a"]) != "a" || string(remote.files["b"]) != "other" {
+		t.Errorf("expected only a to be overwritten, got %q", remote.files)
+	}
+}
+
+func TestQuickXorOnPersonalDrive(t *testing.T) {
+	remote := &fakeRemote{files: map[string][]byte{"a": []byte("a")}, quickXor: true}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	api := onedrive.NewOneDriveAPI(server.Client(), server.URL, "")
+	fs, err := main.NewOneDriveFilesystem(context.Background(), api)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+
+	// the personal drive hashes local files with SHA1, but a only has a
+	// QuickXorHash
+	local := fs.LocalFilesystem()
+	syncer := main.NewSyncer(&local, fs)
+	files, err := syncer.Sync(dir, "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []main.Status{main.STATUS_ALREADY, main.STATUS_UPLOADED}
+	for idx, file := range files {
+		if file.Status != expected[idx] || file.Error != nil {
+			t.Errorf("%s: expected status %q, got %q (%v)", file.Filename, expected[idx], file.Status, file.Error)
+		}
+	}
+
+	files, err = syncer.Verify(dir, "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, file := range files {
+		if file.Status != main.STATUS_ALREADY {
+			t.Errorf("%s: expected status %q, got %q", file.Filename, main.STATUS_ALREADY, file.Status)
+		}
+	}
+
+	// downloads are checked against the QuickXorHash too
+	pullDir := t.TempDir()
+	files, err = syncer.PullStatus(pullDir, "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := syncer.Download(files, pullDir, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, file := range files {
+		if file.Status != main.STATUS_DOWNLOADED || file.Error != nil {
+			t.Errorf("%s: expected status %q, got %q (%v)", file.Filename, main.STATUS_DOWNLOADED, file.Status, file.Error)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+// DefaultProfile is used when no profile is given. It needn't be configured.
+const DefaultProfile = "default"
+
+// Profile is a named account with its own token cache, drive and backup root.
+// Empty fields fall back to the command line flags.
+type Profile struct {
+	Name        string `json:"-"`
+	SecretFile  string `json:"secret_file,omitempty"`
+	ClientID    string `json:"client_id,omitempty"` // instead of the secret file
+	Tenant      string `json:"tenant,omitempty"`
+	AppOnly     bool   `json:"app_only,omitempty"`    // authenticate as the app without a user
+	Certificate string `json:"certificate,omitempty"` // of the app, instead of a client secret
+	Endpoint    string `json:"endpoint,omitempty"`
+	Drive       string `json:"drive,omitempty"`
+	AppFolder   bool   `json:"app_folder,omitempty"`
+	Remote      string `json:"remote,omitempty"` // the default remote root
+	Local       string `json:"local,omitempty"`
+}
+
+// Profiles are the configured profiles by name
+type Profiles map[string]*Profile
+
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadProfiles reads the profiles from a JSON object keyed by profile name.
+// A missing file has no profiles.
+func LoadProfiles(filename string) (Profiles, error) {
+	profiles := make(Profiles)
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &profiles); err != nil {
+		return nil, fmt.Errorf("Could not decode profiles in %s: %w", filename, err)
+	}
+	for name, profile := range profiles {
+		if !validProfileName.MatchString(name) {
+			return nil, fmt.Errorf("Invalid profile name %q in %s", name, filename)
+		}
+		if profile == nil {
+			profile = &Profile{}
+			profiles[name] = profile
+		}
+		profile.Name = name
+	}
+	return profiles, nil
+}
+
+// Get returns the named profile. The default profile exists even if it
+// isn't configured.
+func (p Profiles) Get(name string) (*Profile, error) {
+	if profile, ok := p[name]; ok {
+		return profile, nil
+	} else if name == DefaultProfile {
+		return &Profile{Name: DefaultProfile}, nil
+	}
+	return nil, fmt.Errorf("Unknown profile %q", name)
+}
+
+// Names returns the names of all profiles, including the default profile
+func (p Profiles) Names() []string {
+	names := []string{DefaultProfile}
+	for name := range p {
+		if name != DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// AppName returns the name the token cache of the profile is derived from.
+// The default profile keeps the cache from before profiles existed.
+func (p *Profile) AppName() string {
+	if p.Name == DefaultProfile || p.Name == "" {
+		return "onedrive-sync"
+	}
+	return "onedrive-sync-" + p.Name
+}
+
+// ProfileStatus is a profile along with the identity it is signed in as
+type ProfileStatus struct {
+	Profile
+	Name     string `json:"name"`
+	Identity string `json:"identity,omitempty"` // empty if not signed in
+	Error    string `json:"error,omitempty"`
+}
+
+// listProfiles prints all profiles and the identities they're signed in as.
+// Only cached tokens are used, so profiles that aren't signed in stay that
+// way and no tokens are requested for apps.
+func listProfiles(ctx context.Context, profiles Profiles, explicit map[string]bool, out io.Writer, asJSON bool) error {
+	var statuses []*ProfileStatus
+	for _, name := range profiles.Names() {
+		profile, _ := profiles.Get(name)
+		profile = resolveProfile(profile, explicit)
+		status := &ProfileStatus{Profile: *profile, Name: name}
+		statuses = append(statuses, status)
+
+		var err error
+		if profile.AppOnly {
+			status.Identity, err = appIdentity(profile)
+		} else {
+			status.Identity, err = userIdentity(ctx, profile)
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+	}
+	return PrintProfiles(out, statuses, asJSON)
+}
+
+// userIdentity returns the owner of the drive the profile is signed in to,
+// or nothing if it has no cached token. A profile with a configuration that
+// is missing or invalid is an error rather than not signed in.
+func userIdentity(ctx context.Context, profile *Profile) (string, error) {
+	baseURL, drive, config, opts, err := profileConfig(profile)
+	if err != nil {
+		return "", err
+	}
+	token, err := onedrive.CachedTokenStatus(profile.AppName(), config, opts)
+	if err != nil {
+		return "", err
+	} else if !token.SignedIn {
+		return "", nil
+	} else if token.Encrypted {
+		return "", onedrive.ErrTokenEncrypted
+	}
+	client, err := onedrive.CachedOAuthClient(profile.AppName(), config, opts)
+	if err != nil {
+		return "", err
+	}
+	return accountName(ctx, profileAPI(profile, client, baseURL, drive))
+}
+
+// appIdentity returns the app an app-only profile authenticates as, from its
+// configuration and token cache.
+func appIdentity(profile *Profile) (string, error) {
+	_, _, creds, scopes, err := appConfig(profile)
+	if err != nil {
+		return "", err
+	}
+	token, err := onedrive.AppTokenStatus(profile.AppName(), creds, scopes, tokenOptions)
+	if err != nil {
+		return "", err
+	}
+	identity := "app " + creds.ClientID
+	if !token.SignedIn || token.Encrypted || token.Expiry.Before(time.Now()) {
+		identity += " (no cached token)"
+	}
+	return identity, nil
+}
+
+// PrintProfiles writes the profiles either as a table or as JSON
+func PrintProfiles(out io.Writer, statuses []*ProfileStatus, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tENDPOINT\tDRIVE\tREMOTE\tIDENTITY")
+	for _, status := range statuses {
+		drive := status.Drive
+		if status.AppFolder {
+			drive += " (app folder)"
+		}
+		identity := status.Identity
+		if status.Error != "" {
+			identity = "error: " + status.Error
+		} else if identity == "" {
+			identity = "not signed in"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			status.Name, status.Endpoint, drive, status.Remote, identity)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,79 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jnwhiteh/cloud-backup"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "profiles.json")
+
+	// a missing file only has the default profile
+	profiles, err := main.LoadProfiles(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if profile, err := profiles.Get(main.DefaultProfile); err != nil || profile.AppName() != "onedrive-sync" {
+		t.Errorf("expected the default profile, got %#v (%v)", profile, err)
+	}
+
+	os.WriteFile(filename, []byte(`{
+		"work": {"endpoint": "graph", "drive": "me", "remote": "Backups/laptop"},
+		"personal": {"app_folder": true}
+	}`), 0644)
+	profiles, err = main.LoadProfiles(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if names := profiles.Names(); !reflect.DeepEqual(names, []string{"default", "personal", "work"}) {
+		t.Errorf("unexpected profile names %v", names)
+	}
+
+	work, err := profiles.Get("work")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := &main.Profile{Name: "work", Endpoint: "graph", Drive: "me", Remote: "Backups/laptop"}
+	if !reflect.DeepEqual(work, expected) {
+		t.Errorf("expected %#v, got %#v", expected, work)
+	}
+	if personal, _ := profiles.Get("personal"); personal.AppName() == work.AppName() {
+		t.Errorf("expected profiles to have separate token caches")
+	}
+	if _, err := profiles.Get("missing"); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+
+	os.WriteFile(filename, []byte(`{"../escape": {}}`), 0644)
+	if _, err := main.LoadProfiles(filename); err == nil {
+		t.Errorf("expected an error for an invalid profile name")
+	}
+}
+
+func TestPrintProfiles(t *testing.T) {
+	statuses := []*main.ProfileStatus{
+		{Profile: main.Profile{Endpoint: "onedrive", Drive: "default"}, Name: "default", Identity: "Alice"},
+		{Profile: main.Profile{Endpoint: "graph", Drive: "me", AppFolder: true, Remote: "Backups"}, Name: "work"},
+	}
+
+	var out bytes.Buffer
+	if err := main.PrintProfiles(&out, statuses, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", out.String())
+	}
+	if !strings.HasSuffix(lines[1], "Alice") {
+		t.Errorf("expected the signed in identity, got %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "me (app folder)") || !strings.HasSuffix(lines[2], "not signed in") {
+		t.Errorf("expected an app folder profile that isn't signed in, got %q", lines[2])
+	}
+}
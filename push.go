@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// push uploads the local files that are not on the remote yet, after making
+// sure they fit.
+func push(ctx context.Context, remote *OneDriveFilesystem, profile *Profile) error {
+	local := remote.LocalFilesystem()
+	syncer := NewSyncer(&local, remote)
+	syncer.Overwrite = *overwrite
+	files, err := syncer.SyncStatus(profile.Local, profile.Remote)
+	if err != nil {
+		return fmt.Errorf("Failed when synchronizing %s: %w", profile.Local, err)
+	}
+
+	preflight := NewPreflight(files, remote.Drive.Quota)
+	warnings, err := preflight.Check()
+	if err != nil && !*ignoreQuota {
+		return fmt.Errorf("%w (use -ignore_quota to upload anyway)", err)
+	} else if err != nil {
+		log.Printf("Warning: %s", err)
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	log.Printf("%d files to upload (%s)", preflight.Files, humanize.Bytes(uint64(preflight.Bytes)))
+
+	err = syncer.Upload(files, profile.Remote, progress(preflight.Bytes, STATUS_UPLOADED))
+	if err != nil {
+		return fmt.Errorf("Failed when synchronizing %s: %w", profile.Local, err)
+	}
+	return summarize(ctx, files, STATUS_UPLOADED)
+}
+
+// pull downloads the remote files that are not in the local folder yet
+func pull(ctx context.Context, remote *OneDriveFilesystem, profile *Profile) error {
+	if err := os.MkdirAll(profile.Local, 0755); err != nil {
+		return err
+	}
+	local := remote.LocalFilesystem()
+	syncer := NewSyncer(&local, remote)
+	files, err := syncer.PullStatus(profile.Local, profile.Remote)
+	if err != nil {
+		return fmt.Errorf("Failed when synchronizing %s: %w", profile.Remote, err)
+	}
+
+	preflight := NewPreflight(files, nil)
+	log.Printf("%d files to download (%s)", preflight.Files, humanize.Bytes(uint64(preflight.Bytes)))
+	err = syncer.Download(files, profile.Local, progress(preflight.Bytes, STATUS_DOWNLOADED))
+	if err != nil {
+		return fmt.Errorf("Failed when synchronizing %s: %w", profile.Remote, err)
+	}
+	return summarize(ctx, files, STATUS_DOWNLOADED)
+}
+
+// progress returns a callback for Upload or Download that logs the remaining
+// bytes and an estimate of the time left.
+func progress(remaining int64, transferred Status) func(*SyncStatus) {
+	var mutex sync.Mutex
+	throughput := NewThroughput(time.Now(), time.Minute)
+	return func(file *SyncStatus) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		remaining -= file.Size
+		if file.Status != transferred {
+			return
+		}
+		now := time.Now()
+		throughput.Add(now, file.Size)
+		if eta, ok := throughput.ETA(now, remaining); ok && remaining > 0 {
+			log.Printf("%s remaining at %s/s, about %s left",
+				humanize.Bytes(uint64(remaining)),
+				humanize.Bytes(uint64(throughput.Rate(now))),
+				eta.Round(time.Second))
+		}
+	}
+}
+
+// summarize logs what happened to each file that needed to be synchronized,
+// and returns ERR_INCOMPLETE if any of them still do.
+func summarize(ctx context.Context, files []*SyncStatus, transferred Status) error {
+	var done, pending, conflicts, failed int
+	for _, file := range files {
+		switch {
+		case file.Error != nil && errors.Is(file.Error, ctx.Err()):
+			pending++
+		case file.Error != nil:
+			log.Printf("Failed when transferring %s: %s", file.LocalPath(), file.Error)
+			failed++
+		case file.Status == STATUS_CONFLICT:
+			log.Printf("Conflict: %s was changed remotely, not overwriting", file.LocalPath())
+			conflicts++
+		case file.Status == transferred:
+			log.Printf("%s %s", transferred, file.LocalPath())
+			done++
+		}
+	}
+
+	// anything not transferred is picked up again by the hash comparison on
+	// the next run, and large uploads continue their upload sessions, so an
+	// interrupted run can simply be restarted
+	total := done + pending + conflicts + failed
+	verb := strings.ToLower(string(transferred))
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: interrupted after %s %d of %d files, run again to resume", ERR_INCOMPLETE, verb, done, total)
+	}
+	log.Printf("%s %d of %d files, %d already synchronized", transferred, done, total, len(files)-total)
+	if conflicts > 0 || failed > 0 {
+		return fmt.Errorf("%w: %d conflicts, %d failures", ERR_INCOMPLETE, conflicts, failed)
+	}
+	return nil
+}
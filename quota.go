@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+var ERR_QUOTA_EXCEEDED error = fmt.Errorf("Not enough space on the remote")
+
+// quota prints the quota of the drive
+func quota(ctx context.Context, api *onedrive.OneDriveAPI, args []string, out io.Writer, asJSON bool) error {
+	if len(args) > 0 {
+		return usageError("usage: quota")
+	}
+	drive, err := api.QuotaContext(ctx)
+	if err != nil {
+		return err
+	}
+	return PrintQuota(out, drive, asJSON)
+}
+
+// unknownQuota is the JSON output for a drive that reported no quota
+type unknownQuota struct {
+	State string `json:"state"`
+}
+
+// PrintQuota writes the quota of the drive either as a list or as JSON. A
+// drive that reported no quota has the state "unknown" and no sizes.
+func PrintQuota(out io.Writer, drive *onedrive.Drive, asJSON bool) error {
+	quota := drive.Quota
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if quota == nil {
+			return encoder.Encode(unknownQuota{State: "unknown"})
+		}
+		return encoder.Encode(quota)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Drive:\t%s (%s)\n", drive.Id, drive.DriveType)
+	if quota == nil {
+		fmt.Fprintf(w, "State:\tunknown, the drive reported no quota\n")
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "Total:\t%s\n", humanize.Bytes(uint64(quota.Total)))
+	fmt.Fprintf(w, "Used:\t%s\n", humanize.Bytes(uint64(quota.Used)))
+	fmt.Fprintf(w, "Deleted:\t%s\n", humanize.Bytes(uint64(quota.Deleted)))
+	fmt.Fprintf(w, "Remaining:\t%s\n", humanize.Bytes(uint64(quota.Remaining)))
+	fmt.Fprintf(w, "State:\t%s\n", quota.State)
+	return w.Flush()
+}
+
+// Preflight compares the planned uploads with the space left on the remote
+type Preflight struct {
+	Files     int    // the number of files to upload
+	Bytes     int64  // the total size of the files to upload
+	Remaining int64  // the space left on the remote
+	Deleted   int64  // the space used by the recycle bin
+	State     string // normal, nearing, critical or exceeded
+	Unknown   bool   // the remote reported no quota, so nothing is checked
+}
+
+// NewPreflight totals the size of all files that need to be synchronized
+func NewPreflight(files []*SyncStatus, quota *onedrive.Quota) *Preflight {
+	preflight := &Preflight{}
+	for _, file := range files {
+		if file.Status == STATUS_NEED_SYNC {
+			preflight.Files++
+			preflight.Bytes += file.Size
+		}
+	}
+	if quota == nil {
+		preflight.Unknown = true
+		return preflight
+	}
+	preflight.Remaining = int64(quota.Remaining)
+	preflight.Deleted = int64(quota.Deleted)
+	preflight.State = quota.State
+	return preflight
+}
+
+// Check returns ERR_QUOTA_EXCEEDED if the uploads won't fit, and a list of
+// warnings about the state of the quota otherwise. Without a quota the
+// uploads can't be checked.
+func (p *Preflight) Check() ([]string, error) {
+	if p.Unknown {
+		return []string{"The remote reported no quota, so the available space is unknown"}, nil
+	}
+	if p.Bytes > p.Remaining || (p.State == "exceeded" && p.Files > 0) {
+		var hint string
+		if p.Deleted > 0 && p.Bytes <= p.Remaining+p.Deleted {
+			hint = ", emptying the recycle bin would free enough space"
+		}
+		return nil, fmt.Errorf("%w: %d bytes to upload, %d bytes remaining%s",
+			ERR_QUOTA_EXCEEDED, p.Bytes, p.Remaining, hint)
+	}
+
+	var warnings []string
+	switch p.State {
+	case "nearing", "critical":
+		warnings = append(warnings, fmt.Sprintf("Remote storage is %s its quota", p.State))
+	}
+	if p.Deleted > 0 {
+		warnings = append(warnings, fmt.Sprintf("The recycle bin uses %d bytes", p.Deleted))
+	}
+	return warnings, nil
+}
+
+// throughputSample is the size of an upload and when it completed
+type throughputSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// Throughput estimates the upload rate from the uploads that completed
+// within a recent window of time.
+type Throughput struct {
+	sync.Mutex
+	window  time.Duration
+	started time.Time
+	samples []throughputSample
+}
+
+func NewThroughput(started time.Time, window time.Duration) *Throughput {
+	return &Throughput{window: window, started: started}
+}
+
+// Add records an upload of the given size that completed at the given time
+func (t *Throughput) Add(at time.Time, bytes int64) {
+	t.Lock()
+	defer t.Unlock()
+	t.samples = append(t.samples, throughputSample{at, bytes})
+}
+
+// Rate returns the upload rate in bytes per second at the given time, or zero
+// if nothing was uploaded recently.
+func (t *Throughput) Rate(now time.Time) float64 {
+	t.Lock()
+	defer t.Unlock()
+
+	start := now.Add(-t.window)
+	if start.Before(t.started) {
+		start = t.started
+	}
+
+	// drop the samples that are too old
+	var bytes int64
+	recent := t.samples[:0]
+	for _, sample := range t.samples {
+		if sample.at.After(start) {
+			recent = append(recent, sample)
+			bytes += sample.bytes
+		}
+	}
+	t.samples = recent
+
+	elapsed := now.Sub(start).Seconds()
+	if bytes == 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed
+}
+
+// ETA returns the estimated time to upload the remaining bytes, and false if
+// there's no recent throughput to base it on.
+func (t *Throughput) ETA(now time.Time, remaining int64) (time.Duration, bool) {
+	rate := t.Rate(now)
+	if rate == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second)), true
+}
@@ -0,0 +1,76 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jnwhiteh/cloud-backup"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+func TestPreflight(t *testing.T) {
+	files := []*main.SyncStatus{
+		{HashedFile: main.HashedFile{Filename: "a", Size: 100}, Status: main.STATUS_NEED_SYNC},
+		{HashedFile: main.HashedFile{Filename: "b", Size: 50}, Status: main.STATUS_ALREADY},
+		{HashedFile: main.HashedFile{Filename: "c", Size: 200}, Status: main.STATUS_NEED_SYNC},
+	}
+
+	type testCase struct {
+		quota    onedrive.Quota
+		warnings int
+		err      error
+	}
+
+	testCases := []testCase{
+		testCase{onedrive.Quota{Remaining: 1000, State: "normal"}, 0, nil},
+		testCase{onedrive.Quota{Remaining: 1000, State: "nearing"}, 1, nil},
+		testCase{onedrive.Quota{Remaining: 1000, Deleted: 10, State: "critical"}, 2, nil},
+		testCase{onedrive.Quota{Remaining: 299, State: "critical"}, 0, main.ERR_QUOTA_EXCEEDED},
+		testCase{onedrive.Quota{Remaining: 1000, State: "exceeded"}, 0, main.ERR_QUOTA_EXCEEDED},
+	}
+
+	for idx, test := range testCases {
+		preflight := main.NewPreflight(files, &test.quota)
+		if preflight.Files != 2 || preflight.Bytes != 300 {
+			t.Fatalf("expected 2 files with 300 bytes, got %d with %d", preflight.Files, preflight.Bytes)
+		}
+		warnings, err := preflight.Check()
+		if !errors.Is(err, test.err) {
+			t.Errorf("test %d: expected error %v, got %v", idx, test.err, err)
+		}
+		if len(warnings) != test.warnings {
+			t.Errorf("test %d: expected %d warnings, got %v", idx, test.warnings, warnings)
+		}
+	}
+
+	// drives without a quota facet are not limited by anything we know of
+	warnings, err := main.NewPreflight(files, nil).Check()
+	if err != nil || len(warnings) != 1 {
+		t.Errorf("expected a warning about the unknown quota, got %v (%v)", warnings, err)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	start := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	throughput := main.NewThroughput(start, time.Minute)
+
+	if _, ok := throughput.ETA(start, 1000); ok {
+		t.Errorf("expected no ETA before anything was uploaded")
+	}
+
+	throughput.Add(start.Add(5*time.Second), 500)
+	throughput.Add(start.Add(10*time.Second), 500)
+	if rate := throughput.Rate(start.Add(10 * time.Second)); rate != 100 {
+		t.Errorf("expected 100 bytes/s, got %f", rate)
+	}
+	if eta, ok := throughput.ETA(start.Add(10*time.Second), 3000); !ok || eta != 30*time.Second {
+		t.Errorf("expected an ETA of 30s, got %s", eta)
+	}
+
+	// only recent uploads count
+	throughput.Add(start.Add(100*time.Second), 1200)
+	if rate := throughput.Rate(start.Add(100 * time.Second)); rate != 20 {
+		t.Errorf("expected 20 bytes/s over the last minute, got %f", rate)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+const searchUsage = `usage: search <query> [remote folder]`
+
+// search searches the remote folder, which defaults to the backup root, and
+// prints the results
+func search(ctx context.Context, api *onedrive.OneDriveAPI, args []string, root string, out io.Writer, asJSON bool) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(searchUsage)
+	}
+	if len(args) == 2 {
+		root = args[1]
+	}
+
+	results, err := api.SearchContext(ctx, root, args[0])
+	if err != nil {
+		return err
+	}
+	return PrintSearchResults(out, results, asJSON)
+}
+
+// PrintSearchResults writes the results either as a table or as JSON
+func PrintSearchResults(out io.Writer, results []onedrive.SearchResult, asJSON bool) error {
+	if asJSON {
+		if results == nil {
+			results = []onedrive.SearchResult{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tSIZE\tMODIFIED\tHASH")
+	for _, result := range results {
+		size, hash := humanize.Bytes(uint64(result.Size)), result.Hash
+		if result.Folder {
+			size, hash = "-", "-"
+		} else if hash == "" {
+			hash = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			result.Path, size, result.Modified.Local().Format(time.RFC3339), hash)
+	}
+	return w.Flush()
+}
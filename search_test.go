@@ -0,0 +1,45 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnwhiteh/cloud-backup"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+func TestPrintSearchResults(t *testing.T) {
+	modified := time.Date(2015, 6, 1, 12, 0, 0, 0, time.Local)
+	results := []onedrive.SearchResult{
+		{Path: "Backup/2015/beach.jpg", Size: 2048, Modified: modified, Hash: "abc123"},
+		{Path: "Backup/2015", Modified: modified, Folder: true},
+	}
+
+	var out bytes.Buffer
+	if err := main.PrintSearchResults(&out, results, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", out.String())
+	}
+	expected := "Backup/2015/beach.jpg 2.0 kB " + modified.Format(time.RFC3339) + " abc123"
+	if row := strings.Join(strings.Fields(lines[1]), " "); row != expected {
+		t.Errorf("expected row %q, got %q", expected, row)
+	}
+	if fields := strings.Fields(lines[2]); fields[1] != "-" || fields[3] != "-" {
+		t.Errorf("expected no size or hash for a folder, got %q", lines[2])
+	}
+
+	out.Reset()
+	if err := main.PrintSearchResults(&out, results, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []onedrive.SearchResult
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[0].Hash != "abc123" {
+		t.Errorf("unexpected JSON output %s (%v)", out.String(), err)
+	}
+}
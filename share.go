@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+const shareUsage = `usage: share link <path> [view|edit]
+       share list <path>
+       share revoke <path> <permission id>`
+
+// share manages the sharing links and permissions of a remote path
+func share(ctx context.Context, api *onedrive.OneDriveAPI, args []string, out io.Writer, asJSON bool) error {
+	if len(args) < 2 {
+		return usageError(shareUsage)
+	}
+
+	command, remotePath := args[0], args[1]
+	switch {
+	case command == "link" && len(args) <= 3:
+		linkType := onedrive.ViewLink
+		if len(args) == 3 {
+			linkType = args[2]
+		}
+		perm, err := api.CreateLinkContext(ctx, remotePath, linkType)
+		if err != nil {
+			return err
+		}
+		return PrintPermissions(out, []*onedrive.Permission{perm}, asJSON)
+	case command == "list" && len(args) == 2:
+		perms, err := api.PermissionsContext(ctx, remotePath)
+		if err != nil {
+			return err
+		}
+		return PrintPermissions(out, perms, asJSON)
+	case command == "revoke" && len(args) == 3:
+		if err := api.DeletePermissionContext(ctx, remotePath, args[2]); err != nil {
+			return err
+		}
+		return PrintRevoked(out, remotePath, args[2], asJSON)
+	}
+	return usageError(shareUsage)
+}
+
+// revokedJSON is the JSON output of share revoke
+type revokedJSON struct {
+	Path    string `json:"path"`
+	Id      string `json:"id"`
+	Revoked bool   `json:"revoked"`
+}
+
+// PrintRevoked confirms that the permission of the remote path was revoked,
+// either as a line or as JSON
+func PrintRevoked(out io.Writer, remotePath, id string, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(revokedJSON{Path: remotePath, Id: id, Revoked: true})
+	}
+	_, err := fmt.Fprintf(out, "Revoked permission %s of %s\n", id, remotePath)
+	return err
+}
+
+// PrintPermissions writes the permissions either as a table or as JSON
+func PrintPermissions(out io.Writer, perms []*onedrive.Permission, asJSON bool) error {
+	if asJSON {
+		if perms == nil {
+			perms = []*onedrive.Permission{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(perms)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tROLES\tLINK\tURL\tINHERITED FROM")
+	for _, perm := range perms {
+		linkType, webURL, inherited := "-", "-", "-"
+		if perm.Link != nil {
+			linkType, webURL = perm.Link.Type, perm.Link.WebUrl
+		}
+		if perm.InheritedFrom != nil {
+			inherited = perm.InheritedFrom.Path
+			if inherited == "" {
+				inherited = perm.InheritedFrom.Id
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			perm.Id, strings.Join(perm.Roles, ","), linkType, webURL, inherited)
+	}
+	return w.Flush()
+}
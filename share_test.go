@@ -0,0 +1,82 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jnwhiteh/cloud-backup"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+func TestPrintPermissions(t *testing.T) {
+	perms := []*onedrive.Permission{
+		&onedrive.Permission{
+			Id:    "1",
+			Roles: []string{"read"},
+			Link:  &onedrive.SharingLink{Type: "view", WebUrl: "https://1drv.ms/abc"},
+		},
+		&onedrive.Permission{
+			Id:            "2",
+			Roles:         []string{"write"},
+			InheritedFrom: &onedrive.ItemReference{Path: "/drive/root:/Photos"},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := main.PrintPermissions(&out, perms, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "1 read view https://1drv.ms/abc -" {
+		t.Errorf("unexpected row for the view link: %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "2 write - - /drive/root:/Photos" {
+		t.Errorf("unexpected row for the inherited permission: %q", lines[2])
+	}
+
+	out.Reset()
+	if err := main.PrintPermissions(&out, perms, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []*onedrive.Permission
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s", err)
+	}
+	if len(decoded) != 2 || decoded[1].InheritedFrom.Path != "/drive/root:/Photos" {
+		t.Errorf("unexpected JSON output: %s", out.String())
+	}
+
+	// no permissions is an empty list rather than null
+	out.Reset()
+	main.PrintPermissions(&out, nil, true)
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("expected an empty JSON list, got %q", out.String())
+	}
+}
+
+func TestPrintRevoked(t *testing.T) {
+	var out bytes.Buffer
+	if err := main.PrintRevoked(&out, "Photos/a.jpg", "abc123", false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Revoked permission abc123 of Photos/a.jpg\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	out.Reset()
+	if err := main.PrintRevoked(&out, "Photos/a.jpg", "abc123", true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s", err)
+	}
+	if decoded["id"] != "abc123" || decoded["path"] != "Photos/a.jpg" || decoded["revoked"] != true {
+		t.Errorf("unexpected JSON output: %s", out.String())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+)
+
+// status prints which local files would be uploaded by push
+func status(remote *OneDriveFilesystem, profile *Profile, out io.Writer, asJSON bool) error {
+	local := remote.LocalFilesystem()
+	syncer := NewSyncer(&local, remote)
+	syncer.Overwrite = *overwrite
+	files, err := syncer.SyncStatus(profile.Local, profile.Remote)
+	if err != nil {
+		return fmt.Errorf("Failed when synchronizing %s: %w", profile.Local, err)
+	}
+	return PrintSyncStatus(out, files, asJSON)
+}
+
+// verify prints how the local and remote folders differ, and returns
+// ERR_INCOMPLETE if they do.
+func verify(remote *OneDriveFilesystem, profile *Profile, out io.Writer, asJSON bool) error {
+	local := remote.LocalFilesystem()
+	files, err := NewSyncer(&local, remote).Verify(profile.Local, profile.Remote)
+	if err != nil {
+		return fmt.Errorf("Failed when verifying %s: %w", profile.Local, err)
+	}
+	if err := PrintSyncStatus(out, files, asJSON); err != nil {
+		return err
+	}
+
+	differences := 0
+	for _, file := range files {
+		if file.Status != STATUS_ALREADY {
+			differences++
+		}
+	}
+	if differences > 0 {
+		return fmt.Errorf("%w: %d of %d files differ", ERR_INCOMPLETE, differences, len(files))
+	}
+	return nil
+}
+
+// syncStatusJSON is how a SyncStatus is printed as JSON
+type syncStatusJSON struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Hash   string `json:"hash,omitempty"`
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PrintSyncStatus writes the files and their status either as a table or
+// as JSON
+func PrintSyncStatus(out io.Writer, files []*SyncStatus, asJSON bool) error {
+	if asJSON {
+		results := []syncStatusJSON{}
+		for _, file := range files {
+			result := syncStatusJSON{Name: file.Filename, Size: file.Size, Hash: file.Hash, Status: file.Status}
+			if file.Error != nil {
+				result.Error = file.Error.Error()
+			}
+			results = append(results, result)
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tSTATUS")
+	for _, file := range files {
+		status := string(file.Status)
+		if file.Error != nil {
+			status = "error: " + file.Error.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", file.Filename, humanize.Bytes(uint64(file.Size)), status)
+	}
+	return w.Flush()
+}
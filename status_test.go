@@ -0,0 +1,162 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jnwhiteh/cloud-backup"
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+func TestPrintSyncStatus(t *testing.T) {
+	files := []*main.SyncStatus{
+		&main.SyncStatus{HashedFile: main.HashedFile{Filename: "a.jpg", Size: 2048, Hash: "abc"}, Status: main.STATUS_ALREADY},
+		&main.SyncStatus{HashedFile: main.HashedFile{Filename: "b.jpg", Size: 10}, Status: main.STATUS_NEED_SYNC, Error: io.ErrUnexpectedEOF},
+	}
+
+	var out bytes.Buffer
+	if err := main.PrintSyncStatus(&out, files, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "a.jpg 2.0 kB Already synchronized" {
+		t.Errorf("unexpected row: %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "b.jpg 10 B error: unexpected EOF" {
+		t.Errorf("unexpected row: %q", lines[2])
+	}
+
+	out.Reset()
+	if err := main.PrintSyncStatus(&out, files, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s", err)
+	}
+	if len(decoded) != 2 || decoded[0]["status"] != string(main.STATUS_ALREADY) || decoded[1]["error"] != "unexpected EOF" {
+		t.Errorf("unexpected JSON output: %s", out.String())
+	}
+
+	// no files is an empty list rather than null
+	out.Reset()
+	main.PrintSyncStatus(&out, nil, true)
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("expected an empty JSON list, got %q", out.String())
+	}
+}
+
+func TestPrintItems(t *testing.T) {
+	modified := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	items := []*onedrive.Item{
+		&onedrive.Item{Name: "Albums", Folder: &onedrive.Folder{}},
+		&onedrive.Item{
+			Name:           "beach.jpg",
+			Size:           2048,
+			File:           &onedrive.File{Hashes: &onedrive.Hashes{Sha1Hash: "ABC123"}},
+			FileSystemInfo: &onedrive.FileSystemInfo{LastModifiedDateTime: modified},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := main.PrintItems(&out, items, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "Albums/ - - -" {
+		t.Errorf("unexpected row for the folder: %q", lines[1])
+	}
+	expected := fmt.Sprintf("beach.jpg 2.0 kB %s abc123", modified.Local().Format(time.RFC3339))
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != expected {
+		t.Errorf("unexpected row for the file: %q", lines[2])
+	}
+
+	out.Reset()
+	if err := main.PrintItems(&out, items, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s", err)
+	}
+	if len(decoded) != 2 || decoded[0]["folder"] != true || decoded[1]["hash"] != "abc123" {
+		t.Errorf("unexpected JSON output: %s", out.String())
+	}
+}
+
+func TestPrintQuota(t *testing.T) {
+	drive := &onedrive.Drive{
+		Id:        "drive",
+		DriveType: "personal",
+		Quota:     &onedrive.Quota{Total: 5e9, Used: 1e9, Remaining: 4e9, State: "normal"},
+	}
+
+	var out bytes.Buffer
+	if err := main.PrintQuota(&out, drive, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Drive:      drive (personal)", "Remaining:  4.0 GB", "State:      normal"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in %q", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := main.PrintQuota(&out, drive, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded onedrive.Quota
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || decoded != *drive.Quota {
+		t.Errorf("unexpected JSON output: %s (%v)", out.String(), err)
+	}
+
+	// a drive without a quota is unknown rather than full
+	drive.Quota = nil
+	out.Reset()
+	if err := main.PrintQuota(&out, drive, false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "Remaining") || !strings.Contains(out.String(), "State:  unknown") {
+		t.Errorf("expected an unknown quota, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := main.PrintQuota(&out, drive, true); err != nil {
+		t.Fatal(err)
+	}
+	var unknown map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &unknown); err != nil || len(unknown) != 1 || unknown["state"] != "unknown" {
+		t.Errorf("expected only an unknown state, got %s (%v)", out.String(), err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	type testCase struct {
+		err      error
+		expected int
+	}
+
+	testCases := []testCase{
+		testCase{nil, 0},
+		testCase{io.ErrUnexpectedEOF, 1},
+		testCase{main.ERR_INCOMPLETE, 3},
+		testCase{fmt.Errorf("%w: 2 conflicts, 0 failures", main.ERR_INCOMPLETE), 3},
+	}
+
+	for _, test := range testCases {
+		if code := main.ExitCode(test.err); code != test.expected {
+			t.Errorf("%v: expected exit code %d, got %d", test.err, test.expected, code)
+		}
+	}
+}
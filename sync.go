@@ -1,14 +1,23 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"path"
+	"path/filepath"
 	"sort"
+	"sync"
+	"time"
 )
 
 type HashedFile struct {
 	Folder   string // the path to the parent folder
 	Filename string
-	Hash     string // a hex digest of the file contents
+	Hash     string    // a hex digest of the file contents
+	HashType string    // the type of Hash, if the Filer uses more than one
+	Size     int64     // the size of the file in bytes
+	Modified time.Time // the last modification time, if known
+	ETag     string    // the eTag of the remote file, or of the one a local file replaces
 }
 
 type byName []HashedFile
@@ -28,14 +37,42 @@ type Filer interface {
 	Files(path string) ([]HashedFile, error)
 }
 
+// Rehasher is implemented by a Filer that can hash its files with another
+// type of hash, to compare them with files that only have that type
+type Rehasher interface {
+	// Rehash hashes the files whose name is in hashTypes again with the
+	// type of hash given there
+	Rehash(files []HashedFile, hashTypes map[string]string) error
+}
+
+// Uploader is implemented by a Filer that files can be uploaded to
+type Uploader interface {
+	Filer
+	// Upload the local file to the given remote folder
+	Upload(local HashedFile, remotePath string) error
+}
+
+// Downloader is implemented by a Filer that files can be downloaded from
+type Downloader interface {
+	Filer
+	// Download the remote file into the given local folder
+	Download(remote HashedFile, localPath string) error
+}
+
 type Status string
 
 var (
 	STATUS_ALREADY       Status = "Already synchronized"
 	STATUS_NEED_SYNC     Status = "Needs sync"
 	STATUS_UPLOADED      Status = "Uploaded"
+	STATUS_CONFLICT      Status = "Changed remotely"
+	STATUS_DOWNLOADED    Status = "Downloaded"
+	STATUS_REMOTE_ONLY   Status = "Only on remote"
+	STATUS_MISMATCH      Status = "Contents differ"
 	ERR_REMOTE_NOT_CLEAN error  = fmt.Errorf("Remote folder is not clean")
+	ERR_LOCAL_NOT_CLEAN  error  = fmt.Errorf("Local folder is not clean")
 	ERR_LOCAL_NO_HASH    error  = fmt.Errorf("Local file has no hash")
+	ERR_CONFLICT         error  = fmt.Errorf("Remote file was changed since it was listed")
 )
 
 type SyncStatus struct {
@@ -47,10 +84,14 @@ type SyncStatus struct {
 type Syncer struct {
 	local  Filer
 	remote Filer
+
+	// Overwrite plans remote files whose contents differ to be replaced by
+	// the local ones, instead of failing with ERR_REMOTE_NOT_CLEAN
+	Overwrite bool
 }
 
 func NewSyncer(local Filer, remote Filer) Syncer {
-	return Syncer{local, remote}
+	return Syncer{local: local, remote: remote}
 }
 
 func (s Syncer) SyncStatus(localPath, remotePath string) ([]*SyncStatus, error) {
@@ -71,6 +112,9 @@ func (s Syncer) SyncStatus(localPath, remotePath string) ([]*SyncStatus, error)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.matchHashTypes(localFiles, remoteFiles); err != nil {
+		return nil, err
+	}
 
 	return s.Worklist(localFiles, remoteFiles)
 }
@@ -97,10 +141,17 @@ func (s Syncer) Worklist(localFiles, remoteFiles []HashedFile) ([]*SyncStatus, e
 		remote := remoteFiles[remoteIdx]
 
 		if local.Filename == remote.Filename {
-			if local.Hash == remote.Hash {
+			if local.Hash == remote.Hash || sameSizeAndTime(local, remote) {
 				files = s.addWithStatus(files, local, STATUS_ALREADY)
 				localIdx++
 				remoteIdx++
+			} else if s.Overwrite {
+				// replace the remote file, but only the version that was
+				// listed
+				local.ETag = remote.ETag
+				files = s.addWithStatus(files, local, STATUS_NEED_SYNC)
+				localIdx++
+				remoteIdx++
 			} else {
 				return nil, ERR_REMOTE_NOT_CLEAN
 			}
@@ -116,9 +167,200 @@ func (s Syncer) Worklist(localFiles, remoteFiles []HashedFile) ([]*SyncStatus, e
 	return files, nil
 }
 
+// matchHashTypes hashes the local files again whose remote file of the same
+// name has another type of hash, if the local Filer can, so that the hashes
+// can be compared.
+func (s Syncer) matchHashTypes(localFiles, remoteFiles []HashedFile) error {
+	rehasher, ok := s.local.(Rehasher)
+	if !ok {
+		return nil
+	}
+	remoteTypes := make(map[string]string)
+	for _, remote := range remoteFiles {
+		if remote.Hash != "" {
+			remoteTypes[remote.Filename] = remote.HashType
+		}
+	}
+	hashTypes := make(map[string]string)
+	for _, local := range localFiles {
+		if hashType, ok := remoteTypes[local.Filename]; ok && hashType != local.HashType {
+			hashTypes[local.Filename] = hashType
+		}
+	}
+	if len(hashTypes) == 0 {
+		return nil
+	}
+	return rehasher.Rehash(localFiles, hashTypes)
+}
+
 func (s Syncer) addWithStatus(files []*SyncStatus, file HashedFile, status Status) []*SyncStatus {
 	return append(files, &SyncStatus{
 		HashedFile: file,
 		Status:     status,
 	})
 }
+
+// sameSizeAndTime returns true if the remote file has no hash yet, but its
+// size and modification time match the local file. Remote services may take a
+// while to compute the hash of a freshly uploaded file.
+func sameSizeAndTime(local, remote HashedFile) bool {
+	if remote.Hash != "" || remote.Modified.IsZero() {
+		return false
+	}
+	return local.Size == remote.Size &&
+		local.Modified.Truncate(time.Second).Equal(remote.Modified.Truncate(time.Second))
+}
+
+// the number of concurrent uploads
+var uploadWorkers = 3
+
+// Sync uploads all local files that are not on the remote yet and returns the
+// status of every file, see Upload.
+func (s Syncer) Sync(localPath, remotePath string) ([]*SyncStatus, error) {
+	files, err := s.SyncStatus(localPath, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	return files, s.Upload(files, remotePath, nil)
+}
+
+// Upload uploads the files planned by SyncStatus that need to be synchronized
+// and calls done, if not nil, after each of them. Files that fail to upload
+// carry their error, and files that were changed on the remote since they
+// were listed are marked with STATUS_CONFLICT rather than overwritten.
+func (s Syncer) Upload(files []*SyncStatus, remotePath string, done func(*SyncStatus)) error {
+	uploader, ok := s.remote.(Uploader)
+	if !ok {
+		return fmt.Errorf("Remote does not support uploads")
+	}
+	s.transfer(files, STATUS_UPLOADED, done, func(file HashedFile) error {
+		return uploader.Upload(file, remotePath)
+	})
+	return nil
+}
+
+// PullStatus plans which remote files need to be downloaded into the local
+// folder, like SyncStatus does for uploads. The files are the remote ones,
+// and the local folder may only have files that are on the remote too.
+func (s Syncer) PullStatus(localPath, remotePath string) ([]*SyncStatus, error) {
+	remoteFiles, err := s.remote.Files(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	localFiles, err := s.local.Files(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.matchHashTypes(localFiles, remoteFiles); err != nil {
+		return nil, err
+	}
+
+	files, err := NewSyncer(s.remote, s.local).Worklist(remoteFiles, localFiles)
+	if err == ERR_REMOTE_NOT_CLEAN {
+		return nil, ERR_LOCAL_NOT_CLEAN
+	}
+	return files, err
+}
+
+// Download downloads the files planned by PullStatus that need to be
+// synchronized into the local folder, and calls done, if not nil, after each
+// of them. Files that fail to download carry their error.
+func (s Syncer) Download(files []*SyncStatus, localPath string, done func(*SyncStatus)) error {
+	downloader, ok := s.remote.(Downloader)
+	if !ok {
+		return fmt.Errorf("Remote does not support downloads")
+	}
+	s.transfer(files, STATUS_DOWNLOADED, done, func(file HashedFile) error {
+		return downloader.Download(file, localPath)
+	})
+	return nil
+}
+
+// transfer calls fn concurrently for the files that need to be synchronized,
+// and marks them with the status on success.
+func (s Syncer) transfer(files []*SyncStatus, transferred Status, done func(*SyncStatus), fn func(HashedFile) error) {
+	work := make(chan *SyncStatus)
+	var wg sync.WaitGroup
+	for i := 0; i < uploadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range work {
+				err := fn(file.HashedFile)
+				if errors.Is(err, ERR_CONFLICT) {
+					file.Status = STATUS_CONFLICT
+				} else if err != nil {
+					file.Error = err
+				} else {
+					file.Status = transferred
+				}
+				if done != nil {
+					done(file)
+				}
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if file.Status == STATUS_NEED_SYNC {
+			work <- file
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// Verify compares every file in the local folder with the remote folder,
+// without requiring either to be clean. Files on both sides are
+// STATUS_ALREADY or STATUS_MISMATCH, and files on only one side are
+// STATUS_NEED_SYNC or STATUS_REMOTE_ONLY. A remote file without a hash
+// matches if its size and modification time do.
+func (s Syncer) Verify(localPath, remotePath string) ([]*SyncStatus, error) {
+	localFiles, err := s.local.Files(localPath)
+	if err != nil {
+		return nil, err
+	}
+	remoteFiles, err := s.remote.Files(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.matchHashTypes(localFiles, remoteFiles); err != nil {
+		return nil, err
+	}
+	sort.Sort(byName(localFiles))
+	sort.Sort(byName(remoteFiles))
+
+	var files []*SyncStatus
+	localIdx, remoteIdx := 0, 0
+	for localIdx < len(localFiles) || remoteIdx < len(remoteFiles) {
+		switch {
+		case remoteIdx >= len(remoteFiles) ||
+			(localIdx < len(localFiles) && localFiles[localIdx].Filename < remoteFiles[remoteIdx].Filename):
+			files = s.addWithStatus(files, localFiles[localIdx], STATUS_NEED_SYNC)
+			localIdx++
+		case localIdx >= len(localFiles) || localFiles[localIdx].Filename > remoteFiles[remoteIdx].Filename:
+			files = s.addWithStatus(files, remoteFiles[remoteIdx], STATUS_REMOTE_ONLY)
+			remoteIdx++
+		default:
+			local, remote := localFiles[localIdx], remoteFiles[remoteIdx]
+			if local.Hash == remote.Hash || sameSizeAndTime(local, remote) {
+				files = s.addWithStatus(files, local, STATUS_ALREADY)
+			} else {
+				files = s.addWithStatus(files, local, STATUS_MISMATCH)
+			}
+			localIdx++
+			remoteIdx++
+		}
+	}
+	return files, nil
+}
+
+// LocalPath returns the full path of the local file
+func (f HashedFile) LocalPath() string {
+	return filepath.Join(f.Folder, f.Filename)
+}
+
+// RemotePath returns the path of the file inside the remote folder
+func (f HashedFile) RemotePath(remoteFolder string) string {
+	return path.Join(remoteFolder, f.Filename)
+}
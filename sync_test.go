@@ -6,7 +6,9 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jnwhiteh/cloud-backup"
 )
@@ -32,7 +34,7 @@ func (a mockFS) addFiles(path string, names ...string) {
 		h := md5.New()
 		io.WriteString(h, name)
 		hash := fmt.Sprintf("%x", h.Sum(nil))
-		a.files[path] = append(a.files[path], main.HashedFile{path, name, hash})
+		a.files[path] = append(a.files[path], main.HashedFile{Folder: path, Filename: name, Hash: hash})
 	}
 }
 
@@ -112,3 +114,155 @@ func runTestCase(t *testing.T, path string, local, remote main.Filer, expected [
 		t.Fatalf("status mismatch: expected %#v, got %#v", expected, result)
 	}
 }
+
+func TestUnhashedRemote(t *testing.T) {
+	local := CreateMock("pics/foo", "a", "b")
+	remote := CreateMock("pics/foo", "a", "b")
+	modified := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, files := range [][]main.HashedFile{local.files["pics/foo"], remote.files["pics/foo"]} {
+		for idx := range files {
+			files[idx].Size = 10
+			files[idx].Modified = modified
+		}
+	}
+
+	// a remote file without a hash matches on size and modification time
+	remote.files["pics/foo"][0].Hash = ""
+	local.files["pics/foo"][0].Modified = modified.Add(500 * time.Millisecond)
+	runTestCase(t, "pics/foo", local, remote, []main.Status{main.STATUS_ALREADY, main.STATUS_ALREADY}, nil)
+
+	remote.files["pics/foo"][0].Size = 11
+	runTestCase(t, "pics/foo", local, remote, nil, main.ERR_REMOTE_NOT_CLEAN)
+}
+
+// mockUploader records uploads to a mockFS
+type mockUploader struct {
+	*mockFS
+	sync.Mutex
+	uploaded []string
+	errors   map[string]error
+}
+
+func (u *mockUploader) Upload(local main.HashedFile, remotePath string) error {
+	if err := u.errors[local.Filename]; err != nil {
+		return err
+	}
+	u.Lock()
+	defer u.Unlock()
+	u.uploaded = append(u.uploaded, local.RemotePath(remotePath))
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	local := CreateMock("pics/foo", "a", "b", "c", "d")
+	remote := &mockUploader{
+		mockFS: CreateMock("backup", "a"),
+		errors: map[string]error{
+			"c": main.ERR_CONFLICT,
+			"d": io.ErrUnexpectedEOF,
+		},
+	}
+
+	syncer := main.NewSyncer(local, remote)
+	files, err := syncer.Sync("pics/foo", "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []main.Status{main.STATUS_ALREADY, main.STATUS_UPLOADED, main.STATUS_CONFLICT, main.STATUS_NEED_SYNC}
+	for idx, file := range files {
+		if file.Status != expected[idx] {
+			t.Errorf("%s: expected status %q, got %q", file.Filename, expected[idx], file.Status)
+		}
+	}
+	if files[3].Error != io.ErrUnexpectedEOF {
+		t.Errorf("expected the upload error to be recorded, got %v", files[3].Error)
+	}
+	if !reflect.DeepEqual(remote.uploaded, []string{"backup/b"}) {
+		t.Errorf("expected only backup/b to be uploaded, got %v", remote.uploaded)
+	}
+
+	// a plain Filer can't be synchronized to
+	if _, err := main.NewSyncer(local, remote.mockFS).Sync("pics/foo", "backup"); err == nil {
+		t.Errorf("expected an error for a remote without upload support")
+	}
+}
+
+// mockDownloader records downloads from a mockFS
+type mockDownloader struct {
+	*mockFS
+	sync.Mutex
+	downloaded []string
+	errors     map[string]error
+}
+
+func (d *mockDownloader) Download(remote main.HashedFile, localPath string) error {
+	if err := d.errors[remote.Filename]; err != nil {
+		return err
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.downloaded = append(d.downloaded, remote.RemotePath(localPath))
+	return nil
+}
+
+func TestPull(t *testing.T) {
+	local := CreateMock("pics/foo", "a")
+	remote := &mockDownloader{
+		mockFS: CreateMock("backup", "a", "b", "c"),
+		errors: map[string]error{"c": io.ErrUnexpectedEOF},
+	}
+
+	syncer := main.NewSyncer(local, remote)
+	files, err := syncer.PullStatus("pics/foo", "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := syncer.Download(files, "pics/foo", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []main.Status{main.STATUS_ALREADY, main.STATUS_DOWNLOADED, main.STATUS_NEED_SYNC}
+	for idx, file := range files {
+		if file.Status != expected[idx] {
+			t.Errorf("%s: expected status %q, got %q", file.Filename, expected[idx], file.Status)
+		}
+	}
+	if files[2].Error != io.ErrUnexpectedEOF {
+		t.Errorf("expected the download error to be recorded, got %v", files[2].Error)
+	}
+	if !reflect.DeepEqual(remote.downloaded, []string{"pics/foo/b"}) {
+		t.Errorf("expected only b to be downloaded, got %v", remote.downloaded)
+	}
+
+	// local files that aren't on the remote are left alone
+	local.addFiles("pics/foo", "z")
+	if _, err := syncer.PullStatus("pics/foo", "backup"); err != main.ERR_LOCAL_NOT_CLEAN {
+		t.Errorf("expected %s, got %v", main.ERR_LOCAL_NOT_CLEAN, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	local := CreateMock("pics/foo", "a", "b", "d")
+	remote := CreateMock("backup", "a", "b", "c")
+	remote.files["backup"][1].Hash = "wronghash"
+
+	files, err := main.NewSyncer(local, remote).Verify("pics/foo", "backup")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var result []string
+	for _, file := range files {
+		result = append(result, file.Filename+": "+string(file.Status))
+	}
+	expected := []string{
+		"a: " + string(main.STATUS_ALREADY),
+		"b: " + string(main.STATUS_MISMATCH),
+		"c: " + string(main.STATUS_REMOTE_ONLY),
+		"d: " + string(main.STATUS_NEED_SYNC),
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
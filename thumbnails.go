@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/jnwhiteh/cloud-backup/onedrive"
+)
+
+const thumbnailsUsage = `usage: thumbnails <remote folder> [small|medium|large]`
+
+// thumbnails fetches the thumbnails of all files in a remote folder into the
+// cache and prints their local filenames
+func thumbnails(ctx context.Context, api *onedrive.OneDriveAPI, args []string, cacheDir string, out io.Writer, asJSON bool) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(thumbnailsUsage)
+	}
+	folder, size := args[0], onedrive.SmallThumbnail
+	if len(args) == 2 {
+		size = args[1]
+	}
+
+	files, err := api.ChildHashesContext(ctx, folder)
+	if err != nil {
+		return err
+	}
+
+	cache := onedrive.NewThumbnailCache(api, cacheDir)
+	results := make(map[string]string)
+	for _, file := range files {
+		filename, err := cache.GetContext(ctx, path.Join(folder, file.Name), size)
+		if errors.Is(err, onedrive.PathNotFound) {
+			// not every file has a thumbnail
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Failed when fetching thumbnail of %s: %w", file.Name, err)
+		}
+		results[file.Name] = filename
+		if !asJSON {
+			fmt.Fprintf(out, "%s\t%s\n", file.Name, filename)
+		}
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	return nil
+}